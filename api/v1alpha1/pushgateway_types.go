@@ -18,6 +18,8 @@ package v1alpha1
 
 import (
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -35,6 +37,25 @@ type PushgatewaySpec struct {
 	// +optional
 	Prometheus *PushgatewayPrometheus `json:"prometheus,omitempty"`
 
+	// Whether or not this is the default Pushgateway of the namespace.
+	// Jobs labeled for injection without naming a Pushgateway are injected with it,
+	// when there is more than one Pushgateway in the namespace.
+	// +optional
+	Default bool `json:"default,omitempty"`
+
+	// Namespaces the Pushgateway injects Jobs, CronJobs and other workloads from, in addition to its own.
+	// If omitted, only Jobs in the Pushgateway namespace are injected.
+	// An empty selector matches all namespaces.
+	// Pushgateways in the Job namespace are always preferred.
+	// +optional
+	JobNamespaceSelector *metav1.LabelSelector `json:"jobNamespaceSelector,omitempty"`
+
+	// Labels Jobs, CronJobs and other workloads must have, in addition to the injection label,
+	// to be injected with the Pushgateway.
+	// If omitted, all Jobs labeled for injection are selected.
+	// +optional
+	JobSelector *metav1.LabelSelector `json:"jobSelector,omitempty"`
+
 	// How many replicas of the Pushgateway to run.
 	// Default is 1.
 	// +kubebuilder:default=1
@@ -76,19 +97,136 @@ type PushgatewaySpec struct {
 	// +optional
 	LogFormat string `json:"logFormat,omitempty"`
 
+	// Kind of monitor created for Prometheus to scrape the Pushgateway.
+	// PodMonitor scrapes every Pushgateway pod directly, with a per-pod instance label.
+	// None does not create any monitor.
+	// Default is ServiceMonitor.
+	// +kubebuilder:default=ServiceMonitor
+	// +optional
+	MonitorType MonitorType `json:"monitorType,omitempty"`
+
 	// Override or change some of the created Service Monitor properties
 	// Properties that cannot be overriden: Name, Port, Path, Scheme, HonorLabels and HonorTimestamps
 	// Those can be configured in the relevant fields
 	// +optional
 	ServiceMonitorOverrides *ServiceMonitorOverride `json:"serviceMonitorOverrides,omitempty"`
 
+	// Persist pushed metrics to a PersistentVolumeClaim, so they survive restarts.
+	// When set, the Pushgateway runs as a single replica with a Recreate strategy,
+	// so the persistence file is never written by two pods.
+	// +optional
+	Persistence *PushgatewayPersistence `json:"persistence,omitempty"`
+
+	// Run the Pushgateway as shards which don't share pushed metrics.
+	// When set, the Pushgateway runs as a StatefulSet of one pod per shard instead of a Deployment,
+	// and spec.replicas is ignored. Injected workloads push to a single shard, and every shard is scraped.
+	// Cannot be used with persistence.
+	// +optional
+	Sharding *PushgatewaySharding `json:"sharding,omitempty"`
+
+	// Run spec.replicas Pushgateway replicas behind a push proxy, so pushes are not lost
+	// when a replica restarts. The proxy replicates pushes and deletions to every replica,
+	// and serves reads from the healthy replica which has been running the longest.
+	// The Service, injected workloads and monitors target the proxy.
+	// Cannot be used with sharding, persistence or web.
+	// +optional
+	HighAvailability *PushgatewayHighAvailability `json:"highAvailability,omitempty"`
+
+	// Secure the Pushgateway web endpoint with TLS and basic authentication.
+	// The operator renders the Pushgateway web configuration file into a Secret,
+	// and configures the monitor and injected Jobs accordingly.
+	// +optional
+	Web *PushgatewayWeb `json:"web,omitempty"`
+
+	// Configure how Jobs are injected with the Pushgateway.
+	// +optional
+	Injection *PushgatewayInjection `json:"injection,omitempty"`
+
+	// Delete the metric groups pushed by injected Jobs once they are done,
+	// as the Pushgateway never expires them.
+	// +optional
+	JobCleanup *PushgatewayJobCleanup `json:"jobCleanup,omitempty"`
+
+	// How long metric groups are kept after their last push.
+	// Groups whose push_time_seconds is older are deleted.
+	// If omitted, groups are only expired according to MetricRetentionOverrides.
+	// +optional
+	MetricRetention *metav1.Duration `json:"metricRetention,omitempty"`
+
+	// Retention of the metric groups whose grouping key matches a selector.
+	// The first matching override is used, before MetricRetention.
+	// +optional
+	MetricRetentionOverrides []MetricRetentionOverride `json:"metricRetentionOverrides,omitempty"`
+
+	// Compute resources of the Pushgateway container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Node labels the Pushgateway pods must be scheduled on.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the Pushgateway pods.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Scheduling constraints of the Pushgateway pods.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// How the Pushgateway pods are spread across topology domains.
+	// In high availability mode, the replicas and the push proxy are spread across nodes by default.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// Priority class of the Pushgateway pods.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// Security context of the Pushgateway pods.
+	// Default runs as the non-root user nobody, with the RuntimeDefault seccomp profile.
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// Security context of the Pushgateway container.
+	// Default is a non-root, read-only root filesystem, without privilege escalation
+	// and with all capabilities dropped.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// Secrets used to pull the Pushgateway image.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Service account the Pushgateway pods run as.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Annotations added to the Pushgateway pods.
+	// +optional
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+
+	// Labels added to the Pushgateway pods.
+	// Labels used to select the pods cannot be overriden.
+	// +optional
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+
 	/*
 		TODO:
 		Add override for: metadata, deployment name, service name
-		Add persistence
 	*/
 }
 
+// MonitorType is the kind of monitor created for the Pushgateway
+// +kubebuilder:validation:Enum={ServiceMonitor,PodMonitor,None}
+type MonitorType string
+
+const (
+	MonitorTypeServiceMonitor MonitorType = "ServiceMonitor"
+	MonitorTypePodMonitor     MonitorType = "PodMonitor"
+	MonitorTypeNone           MonitorType = "None"
+)
+
 // PushgatewayPrometheus is the Prometheus instance linked to the Pushgateway, if possible
 // Metrics will be scraped by this Prometheus.
 type PushgatewayPrometheus struct {
@@ -100,6 +238,212 @@ type PushgatewayPrometheus struct {
 	Namespace string `json:"namespace,omitempty"`
 }
 
+// PushgatewayPersistence configures the volume metrics are persisted to.
+type PushgatewayPersistence struct {
+	// StorageClass of the PersistentVolumeClaim.
+	// If omitted, the cluster's default StorageClass is used.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// Size of the PersistentVolumeClaim.
+	// Default is 1Gi.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// Access mode of the PersistentVolumeClaim.
+	// Default is ReadWriteOnce.
+	// +kubebuilder:validation:Enum={ReadWriteOnce,ReadWriteMany,ReadWriteOncePod}
+	// +optional
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+
+	// How often metrics are written to the persistence file.
+	// Default is 5m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// PushgatewaySharding configures how pushes are spread across Pushgateway shards
+type PushgatewaySharding struct {
+	// Number of shards.
+	// Workloads are assigned a shard by consistent hashing of the job label of their grouping key,
+	// or of their CronJob name, so most of them keep their shard when shards are added or removed.
+	// Each shard is reached through its own DNS name, so certificates of secured Pushgateways
+	// must be valid for *.<service>.<namespace>.svc.
+	// +kubebuilder:validation:Minimum=1
+	Shards int32 `json:"shards"`
+}
+
+// PushgatewayHighAvailability configures the push proxy in front of the Pushgateway replicas
+type PushgatewayHighAvailability struct {
+	// Image of the push proxy, built from cmd/push-proxy.
+	// Default is the image the operator is configured with, if any, otherwise it is required.
+	// +optional
+	ProxyImage string `json:"proxyImage,omitempty"`
+
+	// How many replicas of the push proxy to run.
+	// Every proxy replica is scraped and exposes the same metrics.
+	// Default is 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ProxyReplicas int32 `json:"proxyReplicas,omitempty"`
+
+	// Resources of the push proxy container.
+	// +optional
+	ProxyResources corev1.ResourceRequirements `json:"proxyResources,omitempty"`
+}
+
+// PushgatewayWeb configures the Pushgateway web endpoint
+type PushgatewayWeb struct {
+	// Serve the Pushgateway over TLS.
+	// +optional
+	TLS *PushgatewayWebTLS `json:"tls,omitempty"`
+
+	// Secret in the Pushgateway namespace holding the users allowed to access
+	// the Pushgateway, as usernames mapped to plaintext passwords.
+	// Passwords are hashed by the operator.
+	// The operator adds the pushgateway-push user, with a generated password, which is the only user
+	// whose credentials are copied to the namespaces of injected workloads.
+	// +optional
+	BasicAuthUsers *corev1.LocalObjectReference `json:"basicAuthUsers,omitempty"`
+
+	// User Prometheus and the operator authenticate as.
+	// Default is the first user in alphabetical order.
+	// +optional
+	ScrapeUser string `json:"scrapeUser,omitempty"`
+}
+
+// PushgatewayWebTLS configures the Pushgateway TLS server.
+// Secrets are looked for in the Pushgateway namespace.
+type PushgatewayWebTLS struct {
+	// Secret key holding the server certificate.
+	Cert corev1.SecretKeySelector `json:"cert"`
+
+	// Secret key holding the server private key.
+	Key corev1.SecretKeySelector `json:"key"`
+
+	// Secret key holding the CA certificate clients are verified with.
+	// It is also used by Prometheus and the operator to verify the server certificate.
+	// +optional
+	CA *corev1.SecretKeySelector `json:"ca,omitempty"`
+
+	// Policy for TLS client authentication.
+	// Default is NoClientCert.
+	// Policies requiring a client certificate cannot be used, as injected workloads
+	// and the operator do not present one.
+	// +kubebuilder:validation:Enum={NoClientCert,RequestClientCert,RequireAnyClientCert,VerifyClientCertIfGiven,RequireAndVerifyClientCert}
+	// +optional
+	ClientAuthType string `json:"clientAuthType,omitempty"`
+}
+
+// PushgatewayInjection configures the environment variables injected into Jobs,
+// CronJobs, Deployments, StatefulSets, DaemonSets and pods
+type PushgatewayInjection struct {
+	// Whether Jobs and CronJobs must opt in to injection through the inject-pushgateway label,
+	// or are injected unless labeled inject-pushgateway=false, in the namespaces this Pushgateway
+	// injects by default. Jobs and CronJobs of namespaces labeled
+	// pushgateway.monitoring.coreos.com/inject=enabled are injected regardless of the policy.
+	// Default is OptIn.
+	// +kubebuilder:validation:Enum={OptIn,OptOut}
+	// +optional
+	Policy InjectionPolicy `json:"policy,omitempty"`
+
+	// Name of the environment variable holding the Pushgateway URL.
+	// Default is PUSHGATEWAY.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	// +optional
+	EnvVarName string `json:"envVarName,omitempty"`
+
+	// Labels of the grouping key Jobs push under, in order.
+	// Values are Go templates rendered with the .Name, .Namespace, .Labels and .Annotations
+	// of the injected workload or pod, and .PodName, resolved in the pod through the downward API.
+	// A job label is always part of the grouping key, and defaults to {{.Name}}.
+	// Values referring to .PodName, or to the run of CronJobs grouped by run, cannot hold a /.
+	// +optional
+	GroupingKey []GroupingKeyLabel `json:"groupingKey,omitempty"`
+
+	// Whether the grouping key is injected as part of the URL, as separate
+	// environment variables, or both. When only injected as environment variables,
+	// the URL is the Pushgateway address.
+	// Default is URL.
+	// +kubebuilder:validation:Enum={URL,EnvVars,Both}
+	// +optional
+	GroupingKeyMode GroupingKeyMode `json:"groupingKeyMode,omitempty"`
+
+	// Prefix of the environment variables holding the grouping key labels,
+	// followed by the upper-cased label name.
+	// Default is PUSHGATEWAY_LABEL_.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z_][A-Za-z0-9_]*$`
+	// +optional
+	GroupingKeyEnvVarPrefix string `json:"groupingKeyEnvVarPrefix,omitempty"`
+
+	// How the runs of CronJobs are grouped. CronJob pushes all runs under a single
+	// job=<cronjob> group, each run replacing the previous one's metrics; the run
+	// is exposed through the PUSHGATEWAY_RUN environment variable to label metrics with.
+	// Run pushes each run under its own job=<run> group, with a cronjob=<cronjob> label.
+	// Templates are rendered with .Name as the CronJob or run accordingly, .CronJob and .Run.
+	// Default is CronJob.
+	// +kubebuilder:validation:Enum={CronJob,Run}
+	// +optional
+	CronJobGroupingMode CronJobGroupingMode `json:"cronJobGroupingMode,omitempty"`
+}
+
+// InjectionPolicy is whether Jobs opt in or out of injection
+type InjectionPolicy string
+
+const (
+	InjectionPolicyOptIn  InjectionPolicy = "OptIn"
+	InjectionPolicyOptOut InjectionPolicy = "OptOut"
+)
+
+// GroupingKeyLabel is a label of the grouping key of injected Jobs
+type GroupingKeyLabel struct {
+	// Name of the label.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_]*$`
+	Name string `json:"name"`
+
+	// Go template of the label value.
+	Value string `json:"value"`
+}
+
+// GroupingKeyMode is how the grouping key is injected
+type GroupingKeyMode string
+
+const (
+	GroupingKeyModeURL     GroupingKeyMode = "URL"
+	GroupingKeyModeEnvVars GroupingKeyMode = "EnvVars"
+	GroupingKeyModeBoth    GroupingKeyMode = "Both"
+)
+
+// CronJobGroupingMode is how the runs of CronJobs are grouped
+type CronJobGroupingMode string
+
+const (
+	CronJobGroupingModeCronJob CronJobGroupingMode = "CronJob"
+	CronJobGroupingModeRun     CronJobGroupingMode = "Run"
+)
+
+// PushgatewayJobCleanup configures when the metric groups of injected Jobs are deleted.
+// Groups are deleted one by one through the Pushgateway API, which does not require
+// the admin API. Only the groups pushed under the Job name are deleted, never the whole
+// Pushgateway: wiping it requires spec.enableAdminAPI.
+type PushgatewayJobCleanup struct {
+	// How long metric groups are kept after the Job completes or fails,
+	// so Prometheus scrapes them at least once.
+	// Groups of deleted Jobs are deleted right away.
+	// Default is 5m.
+	// +optional
+	Retention *metav1.Duration `json:"retention,omitempty"`
+}
+
+// MetricRetentionOverride sets the retention of some metric groups
+type MetricRetentionOverride struct {
+	// Selects metric groups by the labels of their grouping key, such as job.
+	GroupSelector metav1.LabelSelector `json:"groupSelector"`
+
+	// How long the selected metric groups are kept after their last push.
+	Retention metav1.Duration `json:"retention"`
+}
+
 type ServiceMonitorOverride struct {
 	// Override the Service Monitor object metadata
 	// New metadata will be added to auto-generated metadata
@@ -117,12 +461,81 @@ type ServiceMonitorOverride struct {
 type PushgatewayStatus struct {
 	Prometheus                       string                `json:"prometheus,omitempty"`
 	PrometheusServiceMonitorSelector *metav1.LabelSelector `json:"prometheusServiceMonitorSelector,omitempty"`
+	PrometheusPodMonitorSelector     *metav1.LabelSelector `json:"prometheusPodMonitorSelector,omitempty"`
 	Image                            string                `json:"image,omitempty"`
+
+	// Namespace the ServiceMonitor is created in, so it is selected
+	// by the Prometheus ServiceMonitorNamespaceSelector.
+	// +optional
+	ServiceMonitorNamespace string `json:"serviceMonitorNamespace,omitempty"`
+
+	// Namespace the PodMonitor is created in, so it is selected
+	// by the Prometheus PodMonitorNamespaceSelector.
+	// +optional
+	PodMonitorNamespace string `json:"podMonitorNamespace,omitempty"`
+
+	// The generation observed by the operator.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Desired number of Pushgateway pods, copied from the Deployment or StatefulSet.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Number of ready Pushgateway pods, copied from the Deployment or StatefulSet.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Number of available Pushgateway pods, copied from the Deployment.
+	// StatefulSet pods are available as soon as they are ready.
+	// +optional
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+
+	// Number of metric groups deleted by the last retention check.
+	// +optional
+	ExpiredMetricGroups int32 `json:"expiredMetricGroups,omitempty"`
+
+	// Last time metric groups were deleted because of their retention.
+	// +optional
+	LastMetricExpirationTime *metav1.Time `json:"lastMetricExpirationTime,omitempty"`
+
+	// Number of workloads injected with the Pushgateway which still push with
+	// an outdated configuration, such as Jobs which were running when it changed.
+	// +optional
+	StaleWorkloads int32 `json:"staleWorkloads,omitempty"`
+
+	// Current state of the Pushgateway.
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
+// Pushgateway condition types
+const (
+	// The Pushgateway is available and all its resources are reconciled
+	ConditionReady = "Ready"
+	// A Prometheus instance scrapes the Pushgateway
+	ConditionPrometheusBound = "PrometheusBound"
+	// The Pushgateway Deployment has the minimum number of available pods
+	ConditionDeploymentAvailable = "DeploymentAvailable"
+	// The ServiceMonitor is up to date
+	ConditionServiceMonitorReady = "ServiceMonitorReady"
+	// The PodMonitor is up to date
+	ConditionPodMonitorReady = "PodMonitorReady"
+	// Reconciling the Pushgateway failed
+	ConditionDegraded = "Degraded"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Prometheus",type="string",JSONPath=".status.prometheus",description="Pushgateway's Prometheus instance"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Whether the Pushgateway is ready"
+// +kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".status.replicas",description="Desired number of Pushgateway pods"
+// +kubebuilder:printcolumn:name="Available",type="integer",JSONPath=".status.availableReplicas",description="Number of available Pushgateway pods"
+// +kubebuilder:printcolumn:name="Stale",type="integer",JSONPath=".status.staleWorkloads",description="Number of workloads pushing with an outdated configuration",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 // Pushgateway is the Schema for the pushgateways API
 type Pushgateway struct {
@@ -22,10 +22,43 @@ package v1alpha1
 
 import (
 	"github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GroupingKeyLabel) DeepCopyInto(out *GroupingKeyLabel) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GroupingKeyLabel.
+func (in *GroupingKeyLabel) DeepCopy() *GroupingKeyLabel {
+	if in == nil {
+		return nil
+	}
+	out := new(GroupingKeyLabel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricRetentionOverride) DeepCopyInto(out *MetricRetentionOverride) {
+	*out = *in
+	in.GroupSelector.DeepCopyInto(&out.GroupSelector)
+	out.Retention = in.Retention
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricRetentionOverride.
+func (in *MetricRetentionOverride) DeepCopy() *MetricRetentionOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricRetentionOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Pushgateway) DeepCopyInto(out *Pushgateway) {
 	*out = *in
@@ -53,6 +86,62 @@ func (in *Pushgateway) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushgatewayHighAvailability) DeepCopyInto(out *PushgatewayHighAvailability) {
+	*out = *in
+	in.ProxyResources.DeepCopyInto(&out.ProxyResources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewayHighAvailability.
+func (in *PushgatewayHighAvailability) DeepCopy() *PushgatewayHighAvailability {
+	if in == nil {
+		return nil
+	}
+	out := new(PushgatewayHighAvailability)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushgatewayInjection) DeepCopyInto(out *PushgatewayInjection) {
+	*out = *in
+	if in.GroupingKey != nil {
+		in, out := &in.GroupingKey, &out.GroupingKey
+		*out = make([]GroupingKeyLabel, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewayInjection.
+func (in *PushgatewayInjection) DeepCopy() *PushgatewayInjection {
+	if in == nil {
+		return nil
+	}
+	out := new(PushgatewayInjection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushgatewayJobCleanup) DeepCopyInto(out *PushgatewayJobCleanup) {
+	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewayJobCleanup.
+func (in *PushgatewayJobCleanup) DeepCopy() *PushgatewayJobCleanup {
+	if in == nil {
+		return nil
+	}
+	out := new(PushgatewayJobCleanup)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PushgatewayList) DeepCopyInto(out *PushgatewayList) {
 	*out = *in
@@ -85,6 +174,36 @@ func (in *PushgatewayList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushgatewayPersistence) DeepCopyInto(out *PushgatewayPersistence) {
+	*out = *in
+	if in.StorageClassName != nil {
+		in, out := &in.StorageClassName, &out.StorageClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewayPersistence.
+func (in *PushgatewayPersistence) DeepCopy() *PushgatewayPersistence {
+	if in == nil {
+		return nil
+	}
+	out := new(PushgatewayPersistence)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PushgatewayPrometheus) DeepCopyInto(out *PushgatewayPrometheus) {
 	*out = *in
@@ -100,6 +219,21 @@ func (in *PushgatewayPrometheus) DeepCopy() *PushgatewayPrometheus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushgatewaySharding) DeepCopyInto(out *PushgatewaySharding) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewaySharding.
+func (in *PushgatewaySharding) DeepCopy() *PushgatewaySharding {
+	if in == nil {
+		return nil
+	}
+	out := new(PushgatewaySharding)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PushgatewaySpec) DeepCopyInto(out *PushgatewaySpec) {
 	*out = *in
@@ -108,11 +242,119 @@ func (in *PushgatewaySpec) DeepCopyInto(out *PushgatewaySpec) {
 		*out = new(PushgatewayPrometheus)
 		**out = **in
 	}
+	if in.JobNamespaceSelector != nil {
+		in, out := &in.JobNamespaceSelector, &out.JobNamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JobSelector != nil {
+		in, out := &in.JobSelector, &out.JobSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ServiceMonitorOverrides != nil {
 		in, out := &in.ServiceMonitorOverrides, &out.ServiceMonitorOverrides
 		*out = new(ServiceMonitorOverride)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Persistence != nil {
+		in, out := &in.Persistence, &out.Persistence
+		*out = new(PushgatewayPersistence)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sharding != nil {
+		in, out := &in.Sharding, &out.Sharding
+		*out = new(PushgatewaySharding)
+		**out = **in
+	}
+	if in.HighAvailability != nil {
+		in, out := &in.HighAvailability, &out.HighAvailability
+		*out = new(PushgatewayHighAvailability)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Web != nil {
+		in, out := &in.Web, &out.Web
+		*out = new(PushgatewayWeb)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Injection != nil {
+		in, out := &in.Injection, &out.Injection
+		*out = new(PushgatewayInjection)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JobCleanup != nil {
+		in, out := &in.JobCleanup, &out.JobCleanup
+		*out = new(PushgatewayJobCleanup)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MetricRetention != nil {
+		in, out := &in.MetricRetention, &out.MetricRetention
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MetricRetentionOverrides != nil {
+		in, out := &in.MetricRetentionOverrides, &out.MetricRetentionOverrides
+		*out = make([]MetricRetentionOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]corev1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PodSecurityContext != nil {
+		in, out := &in.PodSecurityContext, &out.PodSecurityContext
+		*out = new(corev1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodAnnotations != nil {
+		in, out := &in.PodAnnotations, &out.PodAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodLabels != nil {
+		in, out := &in.PodLabels, &out.PodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewaySpec.
@@ -133,6 +375,22 @@ func (in *PushgatewayStatus) DeepCopyInto(out *PushgatewayStatus) {
 		*out = new(metav1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PrometheusPodMonitorSelector != nil {
+		in, out := &in.PrometheusPodMonitorSelector, &out.PrometheusPodMonitorSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastMetricExpirationTime != nil {
+		in, out := &in.LastMetricExpirationTime, &out.LastMetricExpirationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewayStatus.
@@ -145,6 +403,53 @@ func (in *PushgatewayStatus) DeepCopy() *PushgatewayStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushgatewayWeb) DeepCopyInto(out *PushgatewayWeb) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(PushgatewayWebTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BasicAuthUsers != nil {
+		in, out := &in.BasicAuthUsers, &out.BasicAuthUsers
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewayWeb.
+func (in *PushgatewayWeb) DeepCopy() *PushgatewayWeb {
+	if in == nil {
+		return nil
+	}
+	out := new(PushgatewayWeb)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushgatewayWebTLS) DeepCopyInto(out *PushgatewayWebTLS) {
+	*out = *in
+	in.Cert.DeepCopyInto(&out.Cert)
+	in.Key.DeepCopyInto(&out.Key)
+	if in.CA != nil {
+		in, out := &in.CA, &out.CA
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushgatewayWebTLS.
+func (in *PushgatewayWebTLS) DeepCopy() *PushgatewayWebTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(PushgatewayWebTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceMonitorOverride) DeepCopyInto(out *ServiceMonitorOverride) {
 	*out = *in
@@ -0,0 +1,89 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// push-proxy replicates pushes to the Pushgateway replicas of a highly available Pushgateway
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/pushproxy"
+)
+
+func main() {
+	var listenAddr string
+	var upstreams string
+	var upstreamTimeout time.Duration
+	var refreshInterval time.Duration
+	flag.StringVar(&listenAddr, "listen-address", ":9091", "The address the proxy listens on.")
+	flag.StringVar(&upstreams, "upstreams", "", "Comma-separated URLs of the Pushgateway replicas.")
+	flag.DurationVar(&upstreamTimeout, "upstream-timeout", 10*time.Second, "Timeout of requests to the Pushgateway replicas.")
+	flag.DurationVar(&refreshInterval, "refresh-interval", 5*time.Second,
+		"How often the replica reads are served from is elected.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	log := ctrl.Log.WithName("push-proxy")
+
+	urls := []*url.URL{}
+	for _, upstream := range strings.Split(upstreams, ",") {
+		if upstream == "" {
+			continue
+		}
+		u, err := url.Parse(upstream)
+		if err != nil {
+			log.Error(err, "invalid upstream", "upstream", upstream)
+			os.Exit(1)
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		log.Error(errors.New("no upstream"), "--upstreams must list at least one Pushgateway replica")
+		os.Exit(1)
+	}
+
+	proxy := pushproxy.New(urls, upstreamTimeout, log)
+	ctx := ctrl.SetupSignalHandler()
+	go proxy.Run(ctx, refreshInterval)
+
+	server := &http.Server{Addr: listenAddr, Handler: proxy}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), upstreamTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "problem shutting down proxy")
+		}
+	}()
+
+	log.Info("starting proxy", "address", listenAddr, "upstreams", upstreams)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error(err, "problem running proxy")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// finalizePushgateway cleans up resources the Pushgateway cannot own
+// and releases it for deletion.
+func (r *PushgatewayReconciler) finalizePushgateway(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(pgw, constants.PushgatewayFinalizer) {
+		return nil
+	}
+
+	// Monitors in the Pushgateway namespace are garbage collected
+	if err := r.deleteStaleServiceMonitors(pgw, pgw.Namespace, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to clean up ServiceMonitors"))
+		return err
+	}
+	if err := r.deleteStalePodMonitors(pgw, pgw.Namespace, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to clean up PodMonitors"))
+		return err
+	}
+	if err := r.deleteStaleScrapeSecrets(pgw, pgw.Namespace, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to clean up scrape Secrets"))
+		return err
+	}
+	if err := r.deleteClientSecrets(pgw, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to clean up client Secrets"))
+		return err
+	}
+
+	controllerutil.RemoveFinalizer(pgw, constants.PushgatewayFinalizer)
+	return r.Update(ctx, pgw)
+}
+
+// deleteStaleServiceMonitors deletes ServiceMonitors created for the Pushgateway
+// outside of the namespace it should currently be in.
+// An empty namespace deletes all of them.
+func (r *PushgatewayReconciler) deleteStaleServiceMonitors(pgw *monitoringv1alpha1.Pushgateway, namespace string, ctx context.Context) error {
+	svcmonList := &monitoringv1.ServiceMonitorList{}
+	if err := r.deleteStaleObjects(pgw, svcmonList, "ServiceMonitor", resources.OwnerLabels(pgw), namespace, ctx); err != nil {
+		return err
+	}
+
+	// ServiceMonitors created before they were labeled can only be found by name
+	if namespace != pgw.Namespace {
+		svcmon := &monitoringv1.ServiceMonitor{}
+		err := r.Get(ctx, types.NamespacedName{Name: resources.ServiceMonitorName(pgw.Name), Namespace: pgw.Namespace}, svcmon)
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if metav1.IsControlledBy(svcmon, pgw) {
+			return client.IgnoreNotFound(r.Delete(ctx, svcmon))
+		}
+	}
+
+	return nil
+}
+
+// deleteStalePodMonitors deletes PodMonitors created for the Pushgateway
+// outside of the namespace it should currently be in.
+// An empty namespace deletes all of them.
+func (r *PushgatewayReconciler) deleteStalePodMonitors(pgw *monitoringv1alpha1.Pushgateway, namespace string, ctx context.Context) error {
+	return r.deleteStaleObjects(pgw, &monitoringv1.PodMonitorList{}, "PodMonitor", resources.OwnerLabels(pgw), namespace, ctx)
+}
+
+// deleteStaleScrapeSecrets deletes scrape Secrets created for the Pushgateway
+// outside of the namespace its monitor is in.
+// An empty namespace deletes all of them.
+func (r *PushgatewayReconciler) deleteStaleScrapeSecrets(pgw *monitoringv1alpha1.Pushgateway, namespace string, ctx context.Context) error {
+	return r.deleteStaleObjects(pgw, &corev1.SecretList{}, "Secret", resources.SecretLabels(pgw, constants.SecretTypeScrape), namespace, ctx)
+}
+
+// deleteClientSecrets deletes the Secrets injected Jobs push with,
+// in every namespace they were copied to
+func (r *PushgatewayReconciler) deleteClientSecrets(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	return r.deleteStaleObjects(pgw, &corev1.SecretList{}, "Secret", resources.SecretLabels(pgw, constants.SecretTypeClient), "", ctx)
+}
+
+// deleteStaleObjects deletes the objects of the list type with the Pushgateway
+// labels outside of namespace
+func (r *PushgatewayReconciler) deleteStaleObjects(pgw *monitoringv1alpha1.Pushgateway, list client.ObjectList, kind string, labels map[string]string, namespace string, ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	if err := r.List(ctx, list, client.MatchingLabels(labels)); err != nil {
+		return err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok || obj.GetNamespace() == namespace {
+			continue
+		}
+		if err := r.Delete(ctx, obj); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		logger.Info(util.LogMessage(pgw, "Deleted "+kind+" "+obj.GetNamespace()+"/"+obj.GetName()))
+	}
+
+	return nil
+}
+
+// watchOwnerLabels maps a ServiceMonitor, PodMonitor or scrape Secret to the Pushgateway
+// it was created for, including those the Pushgateway cannot own
+func (r *PushgatewayReconciler) watchOwnerLabels(obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	name, hasName := labels[constants.OwnerNameLabelName]
+	namespace, hasNamespace := labels[constants.OwnerNamespaceLabelName]
+	if !hasName || !hasNamespace {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}},
+	}
+}
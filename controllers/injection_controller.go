@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/injection"
+	"github.com/prometheus-operator/pushgateway-operator/internal/metrics"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// InjectionReconciler reconciles workloads of the kind of Object.
+// Injection by updating or re-creating workloads is a fallback for clusters where
+// the mutating webhook cannot be used. Pods cannot be injected this way.
+type InjectionReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Object   client.Object
+
+	// Injected copies of the Jobs deleted to be re-created, by name,
+	// until they are created
+	recreations sync.Map
+}
+
+// recreation is the injected copy of a deleted Job waiting to be created
+type recreation struct {
+	obj     client.Object
+	pgw     *monitoringv1alpha1.Pushgateway
+	retries int
+}
+
+func (r *InjectionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// The Job is created again before being reconciled as any other
+	if pending, ok := r.recreations.Load(req.NamespacedName); ok {
+		return r.createRecreation(req.NamespacedName, pending.(*recreation), ctx)
+	}
+
+	instance := r.Object.DeepCopyObject().(client.Object)
+	err := r.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			// Request object not found, could have been deleted after reconcile request.
+			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Return and don't requeue
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		logger.Error(err, "Failed to get workload")
+		return ctrl.Result{}, err
+	}
+
+	return r.ReconcileWorkload(instance, ctx)
+}
+
+// Reconcile workloads to inject them.
+// Desired behaviour:
+// If the workload is selected for injection, inject it, replacing what was injected before
+// If it opts out or its Pushgateway is deleted, remove what was injected
+// Workloads are updated in place, except Jobs which have to be re-created
+// and are never uninjected.
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;update;list;patch;watch;delete;create;
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;update;list;patch;watch;delete;create;
+// +kubebuilder:rbac:groups=batch,resources=cronjobs/finalizers,verbs=update
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;update;list;patch;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+func (r *InjectionReconciler) ReconcileWorkload(obj client.Object, ctx context.Context) (ctrl.Result, error) {
+	pgw, err := injection.GetPushgatewayToInject(r, obj, ctx)
+	if err != nil {
+		// The injection is reversed once its Pushgateway is deleted
+		if deleted, getErr := r.isInjectedPushgatewayDeleted(obj, ctx); getErr == nil && deleted {
+			return ctrl.Result{}, r.uninject(obj, ctx)
+		}
+		r.injectionFailed(obj, err)
+		return ctrl.Result{}, err
+	}
+	if pgw == nil {
+		return ctrl.Result{}, r.uninject(obj, ctx)
+	}
+
+	// Injected Jobs are never re-created: running ones would be disrupted and
+	// finished ones would run again. Their Pushgateway reports them as stale.
+	if injection.IsPodSpecImmutable(obj) && injection.IsInjected(obj) {
+		return ctrl.Result{}, nil
+	}
+
+	if err := injection.EnsureClientSecret(r.Client, pgw, obj.GetNamespace(), ctx); err != nil {
+		r.injectionFailed(obj, err)
+		return ctrl.Result{}, err
+	}
+
+	newObj, updateNeeded, err := injection.Injected(obj, pgw)
+	if err != nil {
+		r.injectionFailed(obj, err)
+		return ctrl.Result{}, err
+	}
+	if !updateNeeded {
+		return ctrl.Result{}, nil
+	}
+
+	if injection.IsPodSpecImmutable(obj) {
+		return r.recreate(obj, newObj, pgw, ctx)
+	}
+
+	if err := r.Update(ctx, newObj); err != nil {
+		r.updateFailed(newObj, err, ctx)
+		return ctrl.Result{}, err
+	}
+	r.injected(newObj, pgw, ctx)
+	return ctrl.Result{}, nil
+}
+
+// Reports the successful injection of the workload
+func (r *InjectionReconciler) injected(obj client.Object, pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) {
+	log.FromContext(ctx).Info(fmt.Sprintf("%s/%s successfully injected", obj.GetNamespace(), obj.GetName()))
+	metrics.InjectedWorkloads.WithLabelValues(obj.GetNamespace(), r.kind()).Inc()
+	r.Recorder.Event(obj, corev1.EventTypeNormal, constants.EventReasonInjected,
+		fmt.Sprintf("Injected with Pushgateway %s/%s", pgw.Namespace, pgw.Name))
+}
+
+// Reports the failure to write the injected workload
+func (r *InjectionReconciler) updateFailed(obj client.Object, err error, ctx context.Context) {
+	log.FromContext(ctx).Error(err, fmt.Sprintf("Failed to inject %s/%s", obj.GetNamespace(), obj.GetName()))
+	metrics.InjectionFailures.WithLabelValues(obj.GetNamespace(), r.kind()).Inc()
+}
+
+// Reports the failure to inject the workload
+func (r *InjectionReconciler) injectionFailed(obj client.Object, err error) {
+	r.Recorder.Event(obj, corev1.EventTypeWarning, constants.EventReasonInjectionFailed, err.Error())
+	metrics.InjectionFailures.WithLabelValues(obj.GetNamespace(), r.kind()).Inc()
+}
+
+// Returns the kind of the reconciled workloads
+func (r *InjectionReconciler) kind() string {
+	gvk, err := apiutil.GVKForObject(r.Object, r.Scheme)
+	if err != nil {
+		return ""
+	}
+	return gvk.Kind
+}
+
+// Removes what was injected into the workload, if anything
+func (r *InjectionReconciler) uninject(obj client.Object, ctx context.Context) error {
+	// Jobs are not re-created only to be uninjected
+	if !injection.IsInjected(obj) || injection.IsPodSpecImmutable(obj) {
+		return nil
+	}
+
+	pgwName := injection.GetInjectedPushgateway(obj)
+	newObj := obj.DeepCopyObject().(client.Object)
+	injection.Uninject(newObj)
+	if err := r.Update(ctx, newObj); err != nil {
+		log.FromContext(ctx).Error(err, fmt.Sprintf("Failed to remove injection from %s/%s", obj.GetNamespace(), obj.GetName()))
+		return err
+	}
+
+	log.FromContext(ctx).Info(fmt.Sprintf("%s/%s injection removed", newObj.GetNamespace(), newObj.GetName()))
+	r.Recorder.Event(newObj, corev1.EventTypeNormal, constants.EventReasonInjectionRemoved,
+		fmt.Sprintf("Removed injection of Pushgateway %s", pgwName))
+	return nil
+}
+
+// Returns whether the Pushgateway the workload was injected with does not exist anymore
+func (r *InjectionReconciler) isInjectedPushgatewayDeleted(obj client.Object, ctx context.Context) (bool, error) {
+	pgwName := injection.GetInjectedPushgateway(obj)
+	parts := strings.SplitN(pgwName, "/", 2)
+	if len(parts) != 2 {
+		return false, nil
+	}
+
+	err := r.Get(ctx, types.NamespacedName{Namespace: parts[0], Name: parts[1]}, &monitoringv1alpha1.Pushgateway{})
+	if k8serrors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// Replaces the object by its injected copy. The copy is kept
+// until it is created, as the object is not deleted right away.
+func (r *InjectionReconciler) recreate(obj client.Object, newObj client.Object, pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	if err := r.Delete(ctx, obj); err != nil {
+		r.updateFailed(newObj, err, ctx)
+		return ctrl.Result{}, err
+	}
+
+	key := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	pending := &recreation{obj: newObj, pgw: pgw}
+	r.recreations.Store(key, pending)
+	return r.createRecreation(key, pending, ctx)
+}
+
+// Creates the injected copy of a deleted Job. It is very likely that the Job
+// still exists right after being deleted: creating it is tried again every
+// {JOB_WAIT_TIME_SECONDS} seconds for a maximum of {JOB_CREATION_TIMEOUT_SECONDS} times.
+func (r *InjectionReconciler) createRecreation(key types.NamespacedName, pending *recreation, ctx context.Context) (ctrl.Result, error) {
+	err := r.Create(ctx, pending.obj)
+	if k8serrors.IsAlreadyExists(err) && pending.retries < constants.JOB_CREATION_TIMEOUT_SECONDS {
+		pending.retries++
+		metrics.JobRecreateRetries.WithLabelValues(key.Namespace).Inc()
+		return ctrl.Result{RequeueAfter: constants.JOB_WAIT_TIME_SECONDS * time.Second}, nil
+	}
+
+	r.recreations.Delete(key)
+	if err != nil {
+		r.updateFailed(pending.obj, err, ctx)
+		return ctrl.Result{}, err
+	}
+	r.injected(pending.obj, pending.pgw, ctx)
+	return ctrl.Result{}, nil
+}
+
+// watchNamespaces maps a Namespace to the workloads it holds, so they are
+// re-evaluated when the Namespace is labeled for injection
+func (r *InjectionReconciler) watchNamespaces(obj client.Object) []reconcile.Request {
+	return r.listWorkloadRequests(func(client.Object) bool { return true }, client.InNamespace(obj.GetName()))
+}
+
+// watchPushgateways maps a Pushgateway to the workloads injected with it and
+// those labeled for injection, so they are re-injected when the Pushgateway
+// changes and uninjected when it is deleted. OptOut Pushgateways also map to
+// every Job and CronJob, which they may inject without labels.
+func (r *InjectionReconciler) watchPushgateways(obj client.Object) []reconcile.Request {
+	pgwName := fmt.Sprintf("%s/%s", obj.GetNamespace(), obj.GetName())
+	optOut := false
+	if pgw, ok := obj.(*monitoringv1alpha1.Pushgateway); ok {
+		optOut = resources.GetInjectionPolicyOrDefault(pgw) == monitoringv1alpha1.InjectionPolicyOptOut
+	}
+	return r.listWorkloadRequests(func(workload client.Object) bool {
+		return injection.GetInjectedPushgateway(workload) == pgwName || injection.IsInjectable(workload) ||
+			optOut && injection.IsInjectableByDefault(workload)
+	})
+}
+
+// Only Pushgateway changes affecting the injection fan out to workloads
+var injectionChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPgw, okOld := e.ObjectOld.(*monitoringv1alpha1.Pushgateway)
+		newPgw, okNew := e.ObjectNew.(*monitoringv1alpha1.Pushgateway)
+		return !okOld || !okNew || injection.IsInjectionChanged(oldPgw, newPgw)
+	},
+}
+
+// Lists the workloads of the reconciled kind for which keep returns true
+func (r *InjectionReconciler) listWorkloadRequests(keep func(client.Object) bool, opts ...client.ListOption) []reconcile.Request {
+	ctx := context.Background()
+	logger := log.FromContext(ctx)
+
+	gvk, err := apiutil.GVKForObject(r.Object, r.Scheme)
+	if err != nil {
+		logger.Error(err, "Failed to get workload kind")
+		return nil
+	}
+	list, err := r.Scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		logger.Error(err, "Failed to create workload list", "kind", gvk.Kind)
+		return nil
+	}
+
+	if err := r.List(ctx, list.(client.ObjectList), opts...); err != nil {
+		logger.Error(err, "Failed to list workloads", "kind", gvk.Kind)
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, item := range items {
+		if workload, ok := item.(client.Object); ok && keep(workload) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: workload.GetName(), Namespace: workload.GetNamespace()},
+			})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *InjectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gvk, err := apiutil.GVKForObject(r.Object, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(strings.ToLower(gvk.Kind)).
+		For(r.Object).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.watchNamespaces),
+			builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Watches(&source.Kind{Type: &monitoringv1alpha1.Pushgateway{}}, handler.EnqueueRequestsFromMapFunc(r.watchPushgateways),
+			builder.WithPredicates(injectionChangedPredicate)).
+		Complete(r)
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/injection"
+	"github.com/prometheus-operator/pushgateway-operator/internal/metrics"
+	"github.com/prometheus-operator/pushgateway-operator/internal/pushgateway"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+// JobCleanupReconciler deletes the metric groups pushed by injected Jobs
+// once they are done, for Pushgateways with Spec.JobCleanup set.
+type JobCleanupReconciler struct {
+	client.Client
+	Scheme      *runtime.Scheme
+	Recorder    record.EventRecorder
+	Pushgateway *pushgateway.Client
+}
+
+func (r *JobCleanupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	instance := &batchv1.Job{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get Job")
+		return ctrl.Result{}, err
+	}
+
+	return r.ReconcileJobCleanup(instance, ctx)
+}
+
+// Reconcile jobs to delete their metric groups.
+// Desired behaviour:
+// Injected Jobs get a finalizer while their Pushgateway cleans up metrics.
+// Metric groups are deleted once the retention has passed after the Job
+// is done, or as soon as the Job is deleted. The finalizer is then released.
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;update;list;patch;watch
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch
+func (r *JobCleanupReconciler) ReconcileJobCleanup(job *batchv1.Job, ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if job.Annotations[constants.JobCleanedUpAnnotationName] == "true" {
+		return ctrl.Result{}, r.releaseJob(job, ctx)
+	}
+
+	pgw, err := r.getJobPushgateway(job, ctx)
+	if err != nil {
+		// Never block the Job deletion because of the Pushgateway
+		logger.Info(fmt.Sprintf("No Pushgateway to clean up Job %s/%s metrics: %s", job.Namespace, job.Name, err))
+		return ctrl.Result{}, r.releaseJob(job, ctx)
+	}
+	if pgw == nil {
+		return ctrl.Result{}, r.releaseJob(job, ctx)
+	}
+
+	if pgw.Spec.JobCleanup == nil {
+		return ctrl.Result{}, r.releaseJob(job, ctx)
+	}
+
+	// Runs grouped under their CronJob replace each other's metrics
+	if injection.GetCronJobOwner(job) != nil && resources.GetCronJobGroupingModeOrDefault(pgw) == monitoringv1alpha1.CronJobGroupingModeCronJob {
+		return ctrl.Result{}, r.releaseJob(job, ctx)
+	}
+
+	if !job.DeletionTimestamp.IsZero() {
+		if err := r.deleteJobMetrics(job, pgw, ctx); err != nil {
+			// Don't hold the Job forever when the Pushgateway is unreachable
+			if time.Since(job.DeletionTimestamp.Time) < constants.JobCleanupDeletionTimeout {
+				return ctrl.Result{}, err
+			}
+			logger.Info(fmt.Sprintf("Giving up deleting Job %s/%s metrics", job.Namespace, job.Name))
+		}
+		return ctrl.Result{}, r.releaseJob(job, ctx)
+	}
+
+	if !controllerutil.ContainsFinalizer(job, constants.JobCleanupFinalizer) {
+		controllerutil.AddFinalizer(job, constants.JobCleanupFinalizer)
+		return ctrl.Result{}, r.Update(ctx, job)
+	}
+
+	finishedAt := jobFinishTime(job)
+	if finishedAt == nil {
+		// Completion is notified by the Job watch
+		return ctrl.Result{}, nil
+	}
+
+	retention := constants.DefaultJobCleanupRetention
+	if pgw.Spec.JobCleanup.Retention != nil {
+		retention = pgw.Spec.JobCleanup.Retention.Duration
+	}
+
+	if wait := time.Until(finishedAt.Add(retention)); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	if err := r.deleteJobMetrics(job, pgw, ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Metrics are not deleted again when the Job is
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[constants.JobCleanedUpAnnotationName] = "true"
+	controllerutil.RemoveFinalizer(job, constants.JobCleanupFinalizer)
+	return ctrl.Result{}, r.Update(ctx, job)
+}
+
+// Deletes the metric groups pushed under the job label of the Job
+func (r *JobCleanupReconciler) deleteJobMetrics(job *batchv1.Job, pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	jobLabel, err := injection.GetJobGroupingKeyValue(job, pgw)
+	if err != nil {
+		// Groups of every pod cannot be told apart from other Jobs' ones
+		logger.Error(err, fmt.Sprintf("Cannot delete Job %s/%s metrics from Pushgateway %s/%s", job.Namespace, job.Name, pgw.Namespace, pgw.Name))
+		r.Recorder.Event(job, corev1.EventTypeWarning, constants.EventReasonMetricsCleanupFailed, err.Error())
+		return nil
+	}
+
+	deleted, err := r.Pushgateway.DeleteJobGroups(pgw, jobLabel, ctx)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("Failed to delete Job %s/%s metrics from Pushgateway %s/%s", job.Namespace, job.Name, pgw.Namespace, pgw.Name))
+		r.Recorder.Event(job, corev1.EventTypeWarning, constants.EventReasonMetricsCleanupFailed, err.Error())
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Deleted %d metric groups of Job %s/%s", deleted, job.Namespace, job.Name))
+	metrics.DeletedMetricGroups.WithLabelValues(pgw.Namespace, pgw.Name).Add(float64(deleted))
+	r.Recorder.Event(job, corev1.EventTypeNormal, constants.EventReasonMetricsDeleted,
+		fmt.Sprintf("Deleted %d metric groups from Pushgateway %s/%s", deleted, pgw.Namespace, pgw.Name))
+	return nil
+}
+
+// Removes the cleanup finalizer, if the Job has it
+func (r *JobCleanupReconciler) releaseJob(job *batchv1.Job, ctx context.Context) error {
+	if !controllerutil.ContainsFinalizer(job, constants.JobCleanupFinalizer) {
+		return nil
+	}
+	controllerutil.RemoveFinalizer(job, constants.JobCleanupFinalizer)
+	return client.IgnoreNotFound(r.Update(ctx, job))
+}
+
+// Returns the Pushgateway the Job was injected with, either directly or
+// through the CronJob which spawned it, or nil if it was not injected.
+// The recorded injection is used rather than the current selection,
+// so relabeling the Job or changing Pushgateways doesn't retarget the cleanup.
+func (r *JobCleanupReconciler) getJobPushgateway(job *batchv1.Job, ctx context.Context) (*monitoringv1alpha1.Pushgateway, error) {
+	var injected client.Object = job
+	if owner := injection.GetCronJobOwner(job); owner != nil && !injection.IsInjected(job) {
+		cronJob := &batchv1.CronJob{}
+		if err := r.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: job.Namespace}, cronJob); err != nil {
+			return nil, err
+		}
+		injected = cronJob
+	}
+
+	name := injection.GetInjectedPushgateway(injected)
+	if name == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid recorded Pushgateway %q", name)
+	}
+
+	pgw := &monitoringv1alpha1.Pushgateway{}
+	if err := r.Get(ctx, types.NamespacedName{Name: parts[1], Namespace: parts[0]}, pgw); err != nil {
+		return nil, err
+	}
+	return pgw, nil
+}
+
+// Only injected Jobs, Jobs spawned by CronJobs, which are injected through
+// their CronJob, and Jobs still holding the finalizer are cleaned up
+func isCleanupCandidate(obj client.Object) bool {
+	return injection.IsInjected(obj) || injection.GetCronJobOwner(obj) != nil ||
+		controllerutil.ContainsFinalizer(obj, constants.JobCleanupFinalizer)
+}
+
+// Returns when the Job completed or failed, or nil if it is still running
+func jobFinishTime(job *batchv1.Job) *time.Time {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return &condition.LastTransitionTime.Time
+		}
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *JobCleanupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("jobcleanup").
+		For(&batchv1.Job{}, builder.WithPredicates(predicate.NewPredicateFuncs(isCleanupCandidate))).
+		Complete(r)
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/injection"
+)
+
+func TestGetJobPushgateway(t *testing.T) {
+	injected := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "etl", Namespace: "jobs"}}
+	current := &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "jobs"},
+		Spec:       monitoringv1alpha1.PushgatewaySpec{Default: true},
+	}
+
+	job := newCleanupJob("backup")
+	inject(t, job, injected)
+	// Relabeled to the default Pushgateway after injection
+	job.Labels = map[string]string{constants.PushgatewayLabelName: "true"}
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "jobs", UID: "cronjob-uid"},
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{Spec: newCleanupJob("").Spec},
+		},
+	}
+	inject(t, cronJob, injected)
+	spawned := newCleanupJob("nightly-1")
+	trueVar := true
+	spawned.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "batch/v1", Kind: "CronJob", Name: "nightly", UID: "cronjob-uid", Controller: &trueVar,
+	}}
+
+	r := &JobCleanupReconciler{Client: newFakeClient(t, injected, current, cronJob)}
+
+	tests := []struct {
+		name string
+		job  *batchv1.Job
+		want string
+	}{
+		{name: "recorded Pushgateway", job: job, want: "etl"},
+		{name: "recorded through the CronJob", job: spawned, want: "etl"},
+		{name: "not injected", job: newCleanupJob("other")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw, err := r.getJobPushgateway(tt.job, context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if pgw != nil {
+				got = pgw.Name
+			}
+			if got != tt.want {
+				t.Errorf("getJobPushgateway() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCleanupCandidate(t *testing.T) {
+	injected := newCleanupJob("injected")
+	inject(t, injected, &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "etl", Namespace: "jobs"}})
+
+	finalized := newCleanupJob("finalized")
+	finalized.Finalizers = []string{constants.JobCleanupFinalizer}
+
+	trueVar := true
+	spawned := newCleanupJob("spawned")
+	spawned.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "nightly", Controller: &trueVar}}
+
+	tests := []struct {
+		name string
+		job  *batchv1.Job
+		want bool
+	}{
+		{name: "injected", job: injected, want: true},
+		{name: "holding the finalizer", job: finalized, want: true},
+		{name: "spawned by a CronJob", job: spawned, want: true},
+		{name: "other", job: newCleanupJob("other"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCleanupCandidate(tt.job); got != tt.want {
+				t.Errorf("isCleanupCandidate() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func newCleanupJob(name string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "jobs"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "job"}}},
+			},
+		},
+	}
+}
+
+func inject(t *testing.T, obj client.Object, pgw *monitoringv1alpha1.Pushgateway) {
+	if _, err := injection.Inject(obj, pgw); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/metrics"
+	"github.com/prometheus-operator/pushgateway-operator/internal/pushgateway"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+)
+
+// MetricRetentionRunner periodically deletes the metric groups of Pushgateways
+// which have not been pushed to for longer than their retention.
+// It is added to the manager as a Runnable, and only runs on the leader.
+// It only patches the expired metric groups in the status, which the
+// PushgatewayReconciler leaves out of its own status patches.
+type MetricRetentionRunner struct {
+	client.Client
+	Pushgateway *pushgateway.Client
+	Interval    time.Duration
+}
+
+// Start checks the retention of metric groups every interval, until the context is done
+func (r *MetricRetentionRunner) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, r.expireMetricGroups, r.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure metric groups are only deleted by the leader
+func (r *MetricRetentionRunner) NeedLeaderElection() bool {
+	return true
+}
+
+func (r *MetricRetentionRunner) expireMetricGroups(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	pgwList := &monitoringv1alpha1.PushgatewayList{}
+	if err := r.List(ctx, pgwList); err != nil {
+		logger.Error(err, "Failed to list Pushgateways")
+		return
+	}
+
+	for i := range pgwList.Items {
+		pgw := &pgwList.Items[i]
+		if pgw.Spec.MetricRetention == nil && len(pgw.Spec.MetricRetentionOverrides) == 0 {
+			continue
+		}
+		if err := r.ExpirePushgatewayMetricGroups(pgw, ctx); err != nil {
+			logger.Error(err, util.LogMessage(pgw, "Failed to expire metric groups"))
+		}
+	}
+}
+
+// ExpirePushgatewayMetricGroups deletes the expired metric groups of the Pushgateway
+// and reports how many were deleted in its status
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=pushgateways/status,verbs=get;update;patch
+func (r *MetricRetentionRunner) ExpirePushgatewayMetricGroups(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	groups, err := r.Pushgateway.ListGroups(pgw, ctx)
+	if err != nil {
+		return err
+	}
+
+	expired := int32(0)
+	now := time.Now()
+	for i := range groups {
+		group := &groups[i]
+		retention := getGroupRetention(pgw, group.Labels)
+		if retention == nil {
+			continue
+		}
+
+		pushTime, err := group.PushTime()
+		if err != nil {
+			logger.Error(err, util.LogMessage(pgw, "Failed to get metric group push time"))
+			continue
+		}
+		if now.Sub(pushTime) < *retention {
+			continue
+		}
+
+		if err := r.Pushgateway.DeleteGroup(pgw, group, ctx); err != nil {
+			return err
+		}
+		logger.Info(util.LogMessage(pgw, fmt.Sprintf("Deleted metric group %s last pushed at %s", pushgateway.GroupPath(pgw, group.Labels), pushTime)))
+		metrics.ExpiredMetricGroups.WithLabelValues(pgw.Namespace, pgw.Name).Inc()
+		expired++
+	}
+
+	if expired == pgw.Status.ExpiredMetricGroups && expired == 0 {
+		return nil
+	}
+
+	patch := client.MergeFrom(pgw.DeepCopy())
+	pgw.Status.ExpiredMetricGroups = expired
+	if expired > 0 {
+		expirationTime := metav1.NewTime(now)
+		pgw.Status.LastMetricExpirationTime = &expirationTime
+	}
+	return r.Status().Patch(ctx, pgw, patch)
+}
+
+// Returns the retention of the metric group with the grouping key,
+// or nil if it never expires
+func getGroupRetention(pgw *monitoringv1alpha1.Pushgateway, groupingKey map[string]string) *time.Duration {
+	for _, override := range pgw.Spec.MetricRetentionOverrides {
+		selector, err := metav1.LabelSelectorAsSelector(&override.GroupSelector)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(labels.Set(groupingKey)) {
+			return &override.Retention.Duration
+		}
+	}
+
+	if pgw.Spec.MetricRetention != nil {
+		return &pgw.Spec.MetricRetention.Duration
+	}
+	return nil
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
@@ -16,7 +21,7 @@ import (
 // GetPrometheus returns a Prometheus instance for the Pushgateway.
 // If Spec.Prometheus is set, the instance will be looked according to
 // to it. Otherwise, default Prometheus is returned.
-//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheuses,verbs=get;list
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheuses,verbs=get;list;watch
 func (r *PushgatewayReconciler) GetPrometheus(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (*monitoringv1.Prometheus, error) {
 	if pgw.Spec.Prometheus == nil {
 		// Default Prometheus will not return an error
@@ -72,3 +77,109 @@ func (r *PushgatewayReconciler) GetDefaultPrometheus(pgw *monitoringv1alpha1.Pus
 
 	return promList.Items[0]
 }
+
+// watchPrometheuses maps a Prometheus instance to the Pushgateways bound to it.
+// A Pushgateway is bound either explicitly through Spec.Prometheus, or
+// implicitly when it relies on the default Prometheus of its namespace.
+// Pushgateways which were bound to it according to their status are enqueued as well,
+// so they are unbound when the Prometheus changes.
+func (r *PushgatewayReconciler) watchPrometheuses(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	logger := log.FromContext(ctx)
+	prometheusName := fmt.Sprintf("%s/%s", obj.GetNamespace(), obj.GetName())
+
+	pgwList := &monitoringv1alpha1.PushgatewayList{}
+	if err := r.List(ctx, pgwList); err != nil {
+		logger.Error(err, "Failed to list Pushgateways", "Prometheus", prometheusName)
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, pgw := range pgwList.Items {
+		if pgw.Status.Prometheus == prometheusName || isBoundToPrometheus(&pgw, obj) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: pgw.Name, Namespace: pgw.Namespace},
+			})
+		}
+	}
+
+	return requests
+}
+
+// isBoundToPrometheus returns whether or not the Pushgateway spec points at the Prometheus instance
+func isBoundToPrometheus(pgw *monitoringv1alpha1.Pushgateway, prometheus client.Object) bool {
+	if pgw.Spec.Prometheus == nil {
+		// Default Prometheus is looked for in the Pushgateway namespace
+		return pgw.Namespace == prometheus.GetNamespace()
+	}
+
+	prometheusNamespace := pgw.Namespace
+	if pgw.Spec.Prometheus.Namespace != "" {
+		prometheusNamespace = pgw.Spec.Prometheus.Namespace
+	}
+
+	return pgw.Spec.Prometheus.Name == prometheus.GetName() && prometheusNamespace == prometheus.GetNamespace()
+}
+
+// GetServiceMonitorNamespace returns the namespace the Pushgateway ServiceMonitor
+// should be created in, so it is selected by the Prometheus ServiceMonitorNamespaceSelector.
+// The Pushgateway namespace is preferred, then the Prometheus namespace, then any
+// other matching namespace.
+//+kubebuilder:rbac:groups=*,resources=namespaces,verbs=get;list;watch
+func (r *PushgatewayReconciler) GetServiceMonitorNamespace(pgw *monitoringv1alpha1.Pushgateway, prometheus *monitoringv1.Prometheus, ctx context.Context) (string, error) {
+	if prometheus == nil {
+		return pgw.Namespace, nil
+	}
+	return r.getMonitorNamespace(pgw, prometheus, prometheus.Spec.ServiceMonitorNamespaceSelector, "ServiceMonitorNamespaceSelector", ctx)
+}
+
+// GetPodMonitorNamespace returns the namespace the Pushgateway PodMonitor
+// should be created in, so it is selected by the Prometheus PodMonitorNamespaceSelector.
+// Namespaces are preferred in the same order as for ServiceMonitors.
+func (r *PushgatewayReconciler) GetPodMonitorNamespace(pgw *monitoringv1alpha1.Pushgateway, prometheus *monitoringv1.Prometheus, ctx context.Context) (string, error) {
+	if prometheus == nil {
+		return pgw.Namespace, nil
+	}
+	return r.getMonitorNamespace(pgw, prometheus, prometheus.Spec.PodMonitorNamespaceSelector, "PodMonitorNamespaceSelector", ctx)
+}
+
+func (r *PushgatewayReconciler) getMonitorNamespace(pgw *monitoringv1alpha1.Pushgateway, prometheus *monitoringv1.Prometheus, nsSelector *metav1.LabelSelector, selectorName string, ctx context.Context) (string, error) {
+	if nsSelector == nil {
+		// Prometheus only selects monitors in its own namespace
+		return prometheus.Namespace, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(nsSelector)
+	if err != nil {
+		return "", err
+	}
+
+	if selector.Empty() {
+		return pgw.Namespace, nil
+	}
+
+	for _, candidate := range []string{pgw.Namespace, prometheus.Namespace} {
+		ns := &corev1.Namespace{}
+		if err := r.Get(ctx, types.NamespacedName{Name: candidate}, ns); err != nil {
+			return "", err
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			return candidate, nil
+		}
+	}
+
+	nsList := &corev1.NamespaceList{}
+	if err := r.List(ctx, nsList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", err
+	}
+
+	if len(nsList.Items) == 0 {
+		return "", fmt.Errorf("no namespace matches the %s of Prometheus %s/%s", selectorName, prometheus.Namespace, prometheus.Name)
+	}
+
+	sort.Slice(nsList.Items, func(i, j int) bool {
+		return nsList.Items[i].Name < nsList.Items[j].Name
+	})
+
+	return nsList.Items[0].Name, nil
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+)
+
+func TestIsBoundToPrometheus(t *testing.T) {
+	prometheus := &monitoringv1.Prometheus{ObjectMeta: metav1.ObjectMeta{Name: "k8s", Namespace: "monitoring"}}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		prometheus *monitoringv1alpha1.PushgatewayPrometheus
+		want       bool
+	}{
+		{name: "default Prometheus of the namespace", namespace: "monitoring", want: true},
+		{name: "default Prometheus of another namespace", namespace: "default", want: false},
+		{name: "explicit", namespace: "default", prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "k8s", Namespace: "monitoring"}, want: true},
+		{name: "explicit in the Pushgateway namespace", namespace: "monitoring", prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "k8s"}, want: true},
+		{name: "other name", namespace: "monitoring", prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "other"}, want: false},
+		{name: "other namespace", namespace: "default", prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "k8s"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := &monitoringv1alpha1.Pushgateway{
+				ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: tt.namespace},
+				Spec:       monitoringv1alpha1.PushgatewaySpec{Prometheus: tt.prometheus},
+			}
+			if got := isBoundToPrometheus(pgw, prometheus); got != tt.want {
+				t.Errorf("isBoundToPrometheus() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchPrometheuses(t *testing.T) {
+	prometheus := &monitoringv1.Prometheus{ObjectMeta: metav1.ObjectMeta{Name: "k8s", Namespace: "monitoring"}}
+	r := &PushgatewayReconciler{Client: newFakeClient(t,
+		// Bound by default
+		&monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "monitoring"}},
+		// Bound explicitly
+		&monitoringv1alpha1.Pushgateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "explicit", Namespace: "jobs"},
+			Spec: monitoringv1alpha1.PushgatewaySpec{
+				Prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "k8s", Namespace: "monitoring"},
+			},
+		},
+		// Bound until now, to be unbound
+		&monitoringv1alpha1.Pushgateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "previous", Namespace: "jobs"},
+			Spec: monitoringv1alpha1.PushgatewaySpec{
+				Prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "other", Namespace: "monitoring"},
+			},
+			Status: monitoringv1alpha1.PushgatewayStatus{Prometheus: "monitoring/k8s"},
+		},
+		// Not bound
+		&monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "unbound", Namespace: "jobs"}},
+	)}
+
+	want := []reconcile.Request{
+		{NamespacedName: client.ObjectKey{Name: "explicit", Namespace: "jobs"}},
+		{NamespacedName: client.ObjectKey{Name: "previous", Namespace: "jobs"}},
+		{NamespacedName: client.ObjectKey{Name: "default", Namespace: "monitoring"}},
+	}
+	if got := r.watchPrometheuses(prometheus); !reflect.DeepEqual(got, want) {
+		t.Errorf("watchPrometheuses() = %v, want %v", got, want)
+	}
+}
+
+func TestGetPrometheus(t *testing.T) {
+	r := &PushgatewayReconciler{Client: newFakeClient(t,
+		&monitoringv1.Prometheus{ObjectMeta: metav1.ObjectMeta{Name: "k8s", Namespace: "monitoring"}},
+		&monitoringv1.Prometheus{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "crowded"}},
+		&monitoringv1.Prometheus{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "crowded"}},
+	)}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		prometheus *monitoringv1alpha1.PushgatewayPrometheus
+		want       string
+		wantErr    bool
+	}{
+		{name: "default", namespace: "monitoring", want: "k8s"},
+		{name: "no default", namespace: "default"},
+		{name: "ambiguous default", namespace: "crowded"},
+		{name: "explicit", namespace: "default", prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "k8s", Namespace: "monitoring"}, want: "k8s"},
+		{name: "explicit missing", namespace: "default", prometheus: &monitoringv1alpha1.PushgatewayPrometheus{Name: "k8s"}, wantErr: true},
+		{name: "explicit without name", namespace: "default", prometheus: &monitoringv1alpha1.PushgatewayPrometheus{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := &monitoringv1alpha1.Pushgateway{
+				ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: tt.namespace},
+				Spec:       monitoringv1alpha1.PushgatewaySpec{Prometheus: tt.prometheus},
+			}
+			got, err := r.GetPrometheus(pgw, context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPrometheus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			name := ""
+			if got != nil {
+				name = got.Name
+			}
+			if name != tt.want {
+				t.Errorf("GetPrometheus() = %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetServiceMonitorNamespace(t *testing.T) {
+	r := &PushgatewayReconciler{Client: newFakeClient(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "jobs"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", Labels: map[string]string{"monitoring": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b-monitors", Labels: map[string]string{"monitors": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a-monitors", Labels: map[string]string{"monitors": "true"}}},
+	)}
+
+	tests := []struct {
+		name       string
+		prometheus *monitoringv1.Prometheus
+		want       string
+		wantErr    bool
+	}{
+		{name: "no Prometheus", want: "jobs"},
+		{name: "no selector", prometheus: newPrometheus(nil), want: "monitoring"},
+		{name: "empty selector", prometheus: newPrometheus(&metav1.LabelSelector{}), want: "jobs"},
+		{
+			name:       "Prometheus namespace selected",
+			prometheus: newPrometheus(&metav1.LabelSelector{MatchLabels: map[string]string{"monitoring": "true"}}),
+			want:       "monitoring",
+		},
+		{
+			name:       "first other namespace selected",
+			prometheus: newPrometheus(&metav1.LabelSelector{MatchLabels: map[string]string{"monitors": "true"}}),
+			want:       "a-monitors",
+		},
+		{
+			name:       "nothing selected",
+			prometheus: newPrometheus(&metav1.LabelSelector{MatchLabels: map[string]string{"missing": "true"}}),
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "jobs"}}
+			got, err := r.GetServiceMonitorNamespace(pgw, tt.prometheus, context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetServiceMonitorNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetServiceMonitorNamespace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Returns a Prometheus in the monitoring namespace selecting ServiceMonitors with nsSelector
+func newPrometheus(nsSelector *metav1.LabelSelector) *monitoringv1.Prometheus {
+	return &monitoringv1.Prometheus{
+		ObjectMeta: metav1.ObjectMeta{Name: "k8s", Namespace: "monitoring"},
+		Spec:       monitoringv1.PrometheusSpec{ServiceMonitorNamespaceSelector: nsSelector},
+	}
+}
+
+// Returns a fake client knowing about Pushgateways and Prometheus resources
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		monitoringv1alpha1.AddToScheme,
+		monitoringv1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
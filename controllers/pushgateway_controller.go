@@ -21,24 +21,36 @@ import (
 	"fmt"
 
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/metrics"
 	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
 	"github.com/prometheus-operator/pushgateway-operator/internal/util"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 )
 
 // PushgatewayReconciler reconciles a Pushgateway object
 type PushgatewayReconciler struct {
 	client.Client
-	Scheme       *runtime.Scheme
-	DefaultImage string
+	// Reads the Secrets referenced by Pushgateways, which are not cached
+	APIReader         client.Reader
+	Scheme            *runtime.Scheme
+	DefaultImage      string
+	DefaultProxyImage string
 }
 
 //+kubebuilder:rbac:groups=monitoring.coreos.com,resources=pushgateways,verbs=get;list;watch;create;update;patch;delete
@@ -61,6 +73,18 @@ func (r *PushgatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
+	if !instance.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalizePushgateway(instance, ctx)
+	}
+
+	// ServiceMonitors in other namespaces have to be cleaned up on deletion
+	if !controllerutil.ContainsFinalizer(instance, constants.PushgatewayFinalizer) {
+		controllerutil.AddFinalizer(instance, constants.PushgatewayFinalizer)
+		if err := r.Update(ctx, instance); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	res, err := r.ReconcilePushgateway(instance, ctx)
 
 	if err != nil {
@@ -74,63 +98,210 @@ func (r *PushgatewayReconciler) ReconcilePushgateway(pgw *monitoringv1alpha1.Pus
 	logger := log.FromContext(ctx)
 	prometheus, err := r.GetPrometheus(pgw, ctx)
 	if err != nil {
+		metrics.PrometheusBindingFailures.WithLabelValues(pgw.Namespace, pgw.Name).Inc()
+		setCondition(pgw, monitoringv1alpha1.ConditionPrometheusBound, metav1.ConditionFalse, constants.ReasonPrometheusNotFound, err.Error())
+		setDegraded(pgw, constants.ReasonPrometheusNotFound, err)
+		if statusErr := r.updateStatus(pgw, ctx); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
 		return ctrl.Result{}, err
 	}
 
 	if prometheus != nil {
 		pgw.Status.Prometheus = fmt.Sprintf("%s/%s", prometheus.Namespace, prometheus.Name)
-		if prometheus.Spec.ServiceMonitorSelector != nil {
-			pgw.Status.PrometheusServiceMonitorSelector = prometheus.Spec.ServiceMonitorSelector
-		}
-		err := r.Status().Update(ctx, pgw)
-		if err != nil {
-			logger.Error(err, util.LogMessage(pgw, "Failed to update status"))
-		}
+		pgw.Status.PrometheusServiceMonitorSelector = prometheus.Spec.ServiceMonitorSelector
+		pgw.Status.PrometheusPodMonitorSelector = prometheus.Spec.PodMonitorSelector
+		setCondition(pgw, monitoringv1alpha1.ConditionPrometheusBound, metav1.ConditionTrue, constants.ReasonPrometheusFound,
+			fmt.Sprintf("Bound to Prometheus %s", pgw.Status.Prometheus))
 		logger.Info(fmt.Sprintf("%s/%s set up with Prometheus %s", pgw.Namespace, pgw.Name, pgw.Status.Prometheus))
 	} else {
 		pgw.Status.Prometheus = "N/A"
-		err := r.Status().Update(ctx, pgw)
-		if err != nil {
-			logger.Error(err, util.LogMessage(pgw, "Failed to update status"))
-		}
+		pgw.Status.PrometheusServiceMonitorSelector = nil
+		pgw.Status.PrometheusPodMonitorSelector = nil
+		setCondition(pgw, monitoringv1alpha1.ConditionPrometheusBound, metav1.ConditionFalse, constants.ReasonPrometheusNotFound,
+			"No single Prometheus instance found in namespace")
 		logger.Info(fmt.Sprintf("No Prometheus instance found for %s/%s", pgw.Namespace, pgw.Name))
 	}
 
+	if err := r.setMonitorNamespace(pgw, prometheus, ctx); err != nil {
+		setDegraded(pgw, constants.ReasonReconcileFailed, err)
+		if statusErr := r.updateStatus(pgw, ctx); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, err
+	}
+
 	pgw.Status.Image = resources.GetImageOrDefault(pgw, r.DefaultImage)
-	r.Status().Update(ctx, pgw)
 
-	res, err := r.reconcilePushgatewayDeployment(pgw, ctx)
+	res, err := r.reconcilePushgatewayResources(pgw, ctx)
+	if err != nil {
+		setDegraded(pgw, constants.ReasonReconcileFailed, err)
+		if statusErr := r.updateStatus(pgw, ctx); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Stale workloads don't make the Pushgateway degraded
+	if err := r.updateStaleWorkloads(pgw, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to count stale workloads"))
+	}
+
+	setCondition(pgw, monitoringv1alpha1.ConditionDegraded, metav1.ConditionFalse, constants.ReasonReconciled, "All resources are reconciled")
+	setReady(pgw)
+
+	if err := r.updateStatus(pgw, ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return res, nil
+}
+
+// Reconciles all the resources owned by the Pushgateway
+func (r *PushgatewayReconciler) reconcilePushgatewayResources(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	res := ctrl.Result{}
+	if pgw.Spec.Persistence != nil {
+		nres, err := r.reconcilePushgatewayPersistentVolumeClaim(pgw, ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info(util.LogMessage(pgw, "Successfully reconciled PersistentVolumeClaim"))
+		res = util.UpdateReconcileResult(res, nres)
+	}
+
+	nres, err := r.reconcilePushgatewayWebConfig(pgw, ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pgw.Spec.Web != nil {
+		logger.Info(util.LogMessage(pgw, "Successfully reconciled web configuration"))
+	}
+	res = util.UpdateReconcileResult(res, nres)
 
+	nres, err = r.reconcilePushgatewayWorkload(pgw, ctx)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	logger.Info(util.LogMessage(pgw, "Successfully reconciled deployment"))
+	res = util.UpdateReconcileResult(res, nres)
+
+	if err := r.updateWorkloadStatus(pgw, ctx); err != nil && !k8serrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
 
-	nres, err := r.reconcilePushgatewayService(pgw, ctx)
+	nres, err = r.reconcilePushgatewayService(pgw, ctx)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 	logger.Info(util.LogMessage(pgw, "Successfully reconciled Service"))
 	res = util.UpdateReconcileResult(res, nres)
 
-	nres, err = r.reconcilePushgatewayServiceMonitor(pgw, ctx)
+	nres, err = r.reconcilePushgatewayMonitor(pgw, ctx)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	logger.Info(util.LogMessage(pgw, "Successfully reconciled ServiceMonitor"))
 	res = util.UpdateReconcileResult(res, nres)
 
 	return res, nil
 }
 
+// Sets the namespace the monitor of the Pushgateway should be created in,
+// according to the monitor type
+func (r *PushgatewayReconciler) setMonitorNamespace(pgw *monitoringv1alpha1.Pushgateway, prometheus *monitoringv1.Prometheus, ctx context.Context) error {
+	var err error
+	pgw.Status.ServiceMonitorNamespace = ""
+	pgw.Status.PodMonitorNamespace = ""
+
+	switch resources.GetMonitorTypeOrDefault(pgw) {
+	case monitoringv1alpha1.MonitorTypeServiceMonitor:
+		pgw.Status.ServiceMonitorNamespace, err = r.GetServiceMonitorNamespace(pgw, prometheus, ctx)
+		if err != nil {
+			setCondition(pgw, monitoringv1alpha1.ConditionServiceMonitorReady, metav1.ConditionFalse, constants.ReasonReconcileFailed, err.Error())
+		}
+	case monitoringv1alpha1.MonitorTypePodMonitor:
+		pgw.Status.PodMonitorNamespace, err = r.GetPodMonitorNamespace(pgw, prometheus, ctx)
+		if err != nil {
+			setCondition(pgw, monitoringv1alpha1.ConditionPodMonitorReady, metav1.ConditionFalse, constants.ReasonReconcileFailed, err.Error())
+		}
+	}
+
+	return err
+}
+
+// Reconciles the monitor of the requested type, and deletes monitors
+// of the other types
+func (r *PushgatewayReconciler) reconcilePushgatewayMonitor(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	switch resources.GetMonitorTypeOrDefault(pgw) {
+	case monitoringv1alpha1.MonitorTypeServiceMonitor:
+		if err := r.deleteStalePodMonitors(pgw, "", ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+		meta.RemoveStatusCondition(&pgw.Status.Conditions, monitoringv1alpha1.ConditionPodMonitorReady)
+
+		res, err := r.reconcilePushgatewayServiceMonitor(pgw, ctx)
+		if err != nil {
+			setCondition(pgw, monitoringv1alpha1.ConditionServiceMonitorReady, metav1.ConditionFalse, constants.ReasonReconcileFailed, err.Error())
+			return ctrl.Result{}, err
+		}
+		setCondition(pgw, monitoringv1alpha1.ConditionServiceMonitorReady, metav1.ConditionTrue, constants.ReasonReconciled, "ServiceMonitor is up to date")
+		logger.Info(util.LogMessage(pgw, "Successfully reconciled ServiceMonitor"))
+		return res, nil
+
+	case monitoringv1alpha1.MonitorTypePodMonitor:
+		if err := r.deleteStaleServiceMonitors(pgw, "", ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+		meta.RemoveStatusCondition(&pgw.Status.Conditions, monitoringv1alpha1.ConditionServiceMonitorReady)
+
+		res, err := r.reconcilePushgatewayPodMonitor(pgw, ctx)
+		if err != nil {
+			setCondition(pgw, monitoringv1alpha1.ConditionPodMonitorReady, metav1.ConditionFalse, constants.ReasonReconcileFailed, err.Error())
+			return ctrl.Result{}, err
+		}
+		setCondition(pgw, monitoringv1alpha1.ConditionPodMonitorReady, metav1.ConditionTrue, constants.ReasonReconciled, "PodMonitor is up to date")
+		logger.Info(util.LogMessage(pgw, "Successfully reconciled PodMonitor"))
+		return res, nil
+	}
+
+	// No monitor is requested, Prometheus is expected to be configured otherwise
+	if err := r.deleteStaleServiceMonitors(pgw, "", ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteStalePodMonitors(pgw, "", ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+	meta.RemoveStatusCondition(&pgw.Status.Conditions, monitoringv1alpha1.ConditionServiceMonitorReady)
+	meta.RemoveStatusCondition(&pgw.Status.Conditions, monitoringv1alpha1.ConditionPodMonitorReady)
+	return ctrl.Result{}, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *PushgatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := indexInjectedPushgateways(mgr); err != nil {
+		return err
+	}
+
+	injectedWorkloadChanged := builder.WithPredicates(injectedWorkloadPredicate)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&monitoringv1alpha1.Pushgateway{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.PersistentVolumeClaim{}).
+		Owns(&corev1.Secret{}).
 		Owns(&monitoringv1.ServiceMonitor{}).
-		//Watches(&source.Kind{Type: &monitoringv1.Prometheuses{}}, handler.EnqueueRequestsFromMapFunc(r.watchPrometheuses)).
-		//Watches(&source.Kind{Type: &batchv1.Job{}}, r.watchJobs).
+		Owns(&monitoringv1.PodMonitor{}).
+		Watches(&source.Kind{Type: &monitoringv1.ServiceMonitor{}}, handler.EnqueueRequestsFromMapFunc(r.watchOwnerLabels)).
+		Watches(&source.Kind{Type: &monitoringv1.PodMonitor{}}, handler.EnqueueRequestsFromMapFunc(r.watchOwnerLabels)).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.watchOwnerLabels)).
+		Watches(&source.Kind{Type: &monitoringv1.Prometheus{}}, handler.EnqueueRequestsFromMapFunc(r.watchPrometheuses)).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(r.watchInjectedWorkloads), injectedWorkloadChanged).
+		Watches(&source.Kind{Type: &batchv1.CronJob{}}, handler.EnqueueRequestsFromMapFunc(r.watchInjectedWorkloads), injectedWorkloadChanged).
+		Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(r.watchInjectedWorkloads), injectedWorkloadChanged).
+		Watches(&source.Kind{Type: &appsv1.StatefulSet{}}, handler.EnqueueRequestsFromMapFunc(r.watchInjectedWorkloads), injectedWorkloadChanged).
+		Watches(&source.Kind{Type: &appsv1.DaemonSet{}}, handler.EnqueueRequestsFromMapFunc(r.watchInjectedWorkloads), injectedWorkloadChanged).
 		Complete(r)
 }
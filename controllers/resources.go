@@ -2,101 +2,412 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strings"
 
-	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
 	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
 	"github.com/prometheus-operator/pushgateway-operator/internal/util"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-/*
-	TODO: Make a generic reconcile function (unstructured?)
-*/
-
 // Reconcile the deployment needed for the pushgateway
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;update;create;list;patch;watch;delete
 func (r *PushgatewayReconciler) reconcilePushgatewayDeployment(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
-	logger := log.FromContext(ctx)
-	found := &appsv1.Deployment{}
-	desired := resources.PushgatewayDeployment(pgw)
+	return ctrl.Result{}, r.applyObject(pgw, resources.PushgatewayDeployment(pgw), ctx)
+}
 
-	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: pgw.Namespace}, found)
+// Reconcile the statefulset running the shards or the replicas of the pushgateway.
+// Its selector is immutable, so it is re-created when switching between sharding and high availability.
+// Its pods are deleted along with it rather than orphaned, as the pods of the new StatefulSet
+// take the same names. Persistence is not supported in these modes, so the metric groups
+// held in memory by the pods are lost until they are pushed again. The Pushgateway validating
+// webhook rejects the changes leading here, so this only happens when it is disabled.
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;update;create;list;patch;watch;delete
+func (r *PushgatewayReconciler) reconcilePushgatewayStatefulSet(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	desired := resources.PushgatewayStatefulSet(pgw)
 
-	//Deployment does not exist. Create it.
-	if err != nil && k8serrors.IsNotFound(err) {
-		return ctrl.Result{Requeue: true}, r.Create(ctx, desired)
-	} else if err != nil {
-		logger.Error(err, util.LogMessage(pgw, "Failed to get Deployment"))
+	found := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, found)
+	if err != nil && !k8serrors.IsNotFound(err) {
 		return ctrl.Result{}, err
 	}
+	if err == nil && !reflect.DeepEqual(found.Spec.Selector, desired.Spec.Selector) {
+		log.FromContext(ctx).Info(util.LogMessage(pgw, "Re-creating StatefulSet "+found.Name+" as its selector changed, its metric groups are lost"))
+		return ctrl.Result{Requeue: true}, r.deleteOwnedObject(pgw, found, found.Name, ctx)
+	}
+
+	return ctrl.Result{}, r.applyObject(pgw, desired, ctx)
+}
 
-	// Check whether or not the deployment has been changed
-	// If it has changed, reconcile it
-	if !reflect.DeepEqual(desired.Spec, found.Spec) {
-		util.MergeMetadata(&desired.ObjectMeta, found.ObjectMeta)
-		return ctrl.Result{Requeue: true}, r.Update(ctx, desired)
+// Reconcile the push proxy and the headless service of the replicas it replicates to
+func (r *PushgatewayReconciler) reconcilePushgatewayProxy(pgw *monitoringv1alpha1.Pushgateway, image string, ctx context.Context) (ctrl.Result, error) {
+	if err := r.applyObject(pgw, resources.PushgatewayReplicasService(pgw), ctx); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, r.applyObject(pgw, resources.PushgatewayProxyDeployment(pgw, image), ctx)
 }
 
-// Reconcile the service needed for the pushgateway
-// +kubebuilder:rbac:groups=*,resources=services,verbs=get;update;create;list;patch;watch;delete
-func (r *PushgatewayReconciler) reconcilePushgatewayService(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+// Deletes the push proxy and the headless service of the replicas, once high availability is disabled
+func (r *PushgatewayReconciler) deletePushgatewayProxy(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	if err := r.deleteOwnedObject(pgw, &appsv1.Deployment{}, resources.ProxyDeploymentName(pgw), ctx); err != nil {
+		return err
+	}
+	return r.deleteOwnedObject(pgw, &corev1.Service{}, resources.ReplicasServiceName(pgw), ctx)
+}
+
+// Reconcile the Deployment running the pushgateway or, when it is sharded or highly available,
+// the StatefulSet running it, and deletes what was created for the other modes
+func (r *PushgatewayReconciler) reconcilePushgatewayWorkload(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
-	found := &corev1.Service{}
-	desired := resources.PushgatewayService(pgw)
 
-	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: pgw.Namespace}, found)
+	if resources.IsHighlyAvailable(pgw) {
+		// The push proxy image is not published, so it has no built-in default
+		image := resources.GetProxyImageOrDefault(pgw, r.DefaultProxyImage)
+		if image == "" {
+			return ctrl.Result{}, fmt.Errorf("spec.highAvailability.proxyImage must be set, the operator has no default push proxy image")
+		}
+		if err := r.deleteOwnedObject(pgw, &appsv1.Deployment{}, resources.DeploymentName(pgw), ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+		res, err := r.reconcilePushgatewayStatefulSet(pgw, ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		nres, err := r.reconcilePushgatewayProxy(pgw, image, ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info(util.LogMessage(pgw, "Successfully reconciled StatefulSet and push proxy"))
+		return util.UpdateReconcileResult(res, nres), nil
+	}
 
-	//Service does not exist. Create it.
-	if err != nil && k8serrors.IsNotFound(err) {
-		return ctrl.Result{Requeue: true}, r.Create(ctx, desired)
-	} else if err != nil {
-		logger.Error(err, util.LogMessage(pgw, "Failed to get Service"))
+	if err := r.deletePushgatewayProxy(pgw, ctx); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// Check whether or not the service has been changed
-	// If it has changed, reconcile it
-	if !reflect.DeepEqual(desired.Spec, found.Spec) {
-		util.MergeMetadata(&desired.ObjectMeta, found.ObjectMeta)
-		return ctrl.Result{Requeue: true}, r.Update(ctx, desired)
+	if resources.IsSharded(pgw) {
+		if err := r.deleteOwnedObject(pgw, &appsv1.Deployment{}, resources.DeploymentName(pgw), ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+		res, err := r.reconcilePushgatewayStatefulSet(pgw, ctx)
+		if err == nil {
+			logger.Info(util.LogMessage(pgw, "Successfully reconciled StatefulSet"))
+		}
+		return res, err
 	}
 
-	return ctrl.Result{}, nil
+	if err := r.deleteOwnedObject(pgw, &appsv1.StatefulSet{}, resources.StatefulSetName(pgw), ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+	res, err := r.reconcilePushgatewayDeployment(pgw, ctx)
+	if err == nil {
+		logger.Info(util.LogMessage(pgw, "Successfully reconciled deployment"))
+	}
+	return res, err
+}
+
+// Reconcile the service needed for the pushgateway
+// +kubebuilder:rbac:groups=*,resources=services,verbs=get;update;create;list;patch;watch;delete
+func (r *PushgatewayReconciler) reconcilePushgatewayService(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	return ctrl.Result{}, r.applyObject(pgw, resources.PushgatewayService(pgw), ctx)
 }
 
 // Reconcile the service monitor needed for the pushgateway
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;update;create;list;patch;watch;delete
 func (r *PushgatewayReconciler) reconcilePushgatewayServiceMonitor(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
-	found := &monitoringv1.ServiceMonitor{}
 	desired := resources.PushgatewayServiceMonitor(pgw)
 
-	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: pgw.Namespace}, found)
+	// The ServiceMonitor may have moved to another namespace
+	if err := r.deleteStaleServiceMonitors(pgw, desired.Namespace, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to delete stale ServiceMonitors"))
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.applyObject(pgw, desired, ctx)
+}
+
+// Reconcile the pod monitor needed for the pushgateway
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=podmonitors,verbs=get;update;create;list;patch;watch;delete
+func (r *PushgatewayReconciler) reconcilePushgatewayPodMonitor(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	desired := resources.PushgatewayPodMonitor(pgw)
+
+	// The PodMonitor may have moved to another namespace
+	if err := r.deleteStalePodMonitors(pgw, desired.Namespace, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to delete stale PodMonitors"))
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, r.applyObject(pgw, desired, ctx)
+}
+
+// deleteOwnedObject deletes the object of the Pushgateway namespace with the name,
+// if it exists and is controlled by the Pushgateway
+func (r *PushgatewayReconciler) deleteOwnedObject(pgw *monitoringv1alpha1.Pushgateway, obj client.Object, name string, ctx context.Context) error {
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: pgw.Namespace}, obj)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, pgw) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, obj))
+}
+
+// applyObject creates or updates the object through server-side apply.
+// The operator only owns the fields it sets, so other controllers may manage
+// the rest of the object, and fields it no longer sets are removed.
+// Builders must be deterministic: applying an unchanged object does not update it,
+// but any change would trigger another reconcile through the watch on owned objects.
+func (r *PushgatewayReconciler) applyObject(pgw *monitoringv1alpha1.Pushgateway, desired client.Object, ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	// Apply patches are sent with their type
+	gvk, err := apiutil.GVKForObject(desired, r.Scheme)
+	if err != nil {
+		return err
+	}
+
+	patch, err := applyPatch(desired)
+	if err != nil {
+		return err
+	}
+	patch.SetGroupVersionKind(gvk)
+
+	if err := r.Patch(ctx, patch, client.Apply, client.FieldOwner(constants.FieldManager), client.ForceOwnership); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to apply "+gvk.Kind+" "+desired.GetNamespace()+"/"+desired.GetName()))
+		return err
+	}
+
+	return nil
+}
+
+// applyPatch converts the typed object to the fields applied for it.
+// Typed objects serialize their unset structs as empty objects and their unset
+// timestamps as null, which would make the operator own fields defaulted by
+// the API server. The status is never applied.
+func applyPatch(obj client.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	pruneUnsetFields(content, reflect.ValueOf(obj))
+	return &unstructured.Unstructured{Object: content}, nil
+}
 
-	//ServiceMonitor does not exist. Create it.
-	if err != nil && k8serrors.IsNotFound(err) {
-		return ctrl.Result{Requeue: true}, r.Create(ctx, desired)
-	} else if err != nil {
-		logger.Error(err, util.LogMessage(pgw, "Failed to get ServiceMonitor"))
+// pruneUnsetFields removes the null fields of the object, recursively, along with the
+// empty objects serialized from struct fields which are not pointers, as those are unset.
+// Empty objects set through a pointer, such as an emptyDir volume source or a
+// label selector matching everything, are kept. value is the typed object content
+// was converted from: fields it has no type for are only pruned of nulls.
+func pruneUnsetFields(content map[string]interface{}, value reflect.Value) {
+	fields := jsonFields(value)
+	for key, item := range content {
+		field, typed := fields[key]
+		switch item := item.(type) {
+		case nil:
+			delete(content, key)
+		case map[string]interface{}:
+			if !typed {
+				pruneUnsetFields(item, reflect.Value{})
+				continue
+			}
+			if field.Kind() == reflect.Map {
+				for name, entry := range item {
+					if entry, ok := entry.(map[string]interface{}); ok {
+						pruneUnsetFields(entry, field.MapIndex(reflect.ValueOf(name).Convert(field.Type().Key())))
+					}
+				}
+				continue
+			}
+			pruneUnsetFields(item, field)
+			if len(item) == 0 && field.Kind() == reflect.Struct {
+				delete(content, key)
+			}
+		case []interface{}:
+			for i, entry := range item {
+				entry, ok := entry.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if typed && field.Kind() == reflect.Slice && i < field.Len() {
+					pruneUnsetFields(entry, field.Index(i))
+				} else {
+					pruneUnsetFields(entry, reflect.Value{})
+				}
+			}
+		}
+	}
+}
+
+// Returns the fields of the struct, pointed to or not, by their JSON name.
+// Inlined and embedded structs have their fields merged in.
+func jsonFields(value reflect.Value) map[string]reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) {
+		value = value.Elem()
+	}
+	fields := map[string]reflect.Value{}
+	if !value.IsValid() || value.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if name == "" && (field.Anonymous || strings.Contains(field.Tag.Get("json"), "inline")) {
+			for inlined, inlinedValue := range jsonFields(value.Field(i)) {
+				fields[inlined] = inlinedValue
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = value.Field(i)
+	}
+	return fields
+}
+
+// Reconcile the secrets holding the pushgateway web configuration and the credentials
+// it is scraped with. Secrets are only updated when the web configuration changes.
+// Only the Secrets created by the operator are cached and watched, the Secrets referenced
+// by the web configuration are read again every WebSecretsResyncInterval.
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;list;patch;watch;delete
+func (r *PushgatewayReconciler) reconcilePushgatewayWebConfig(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if pgw.Spec.Web == nil {
+		return ctrl.Result{}, r.deleteWebConfig(pgw, ctx)
+	}
+
+	creds, err := GetWebCredentials(r.APIReader, pgw, ctx)
+	if err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to get web credentials"))
+		return ctrl.Result{}, err
+	}
+
+	desired, err := resources.PushgatewayWebConfigSecret(pgw, creds)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	res, err := r.reconcileWebSecret(pgw, desired, ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Prometheus reads the scrape credentials from the monitor namespace
+	namespace := getMonitorNamespace(pgw)
+	if err := r.deleteStaleScrapeSecrets(pgw, namespace, ctx); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to delete stale scrape Secrets"))
+		return ctrl.Result{}, err
+	}
+
+	if namespace != "" {
+		nres, err := r.reconcileWebSecret(pgw, resources.PushgatewayScrapeSecret(pgw, creds, namespace), ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		res = util.UpdateReconcileResult(res, nres)
+	}
+
+	// Client Secrets are created when Jobs are injected, and kept up to date here
+	clientSecrets := &corev1.SecretList{}
+	if err := r.List(ctx, clientSecrets, client.MatchingLabels(resources.SecretLabels(pgw, constants.SecretTypeClient))); err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, secret := range clientSecrets.Items {
+		nres, err := r.reconcileWebSecret(pgw, resources.PushgatewayClientSecret(pgw, desired, secret.Namespace), ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		res = util.UpdateReconcileResult(res, nres)
+	}
+
+	return util.UpdateReconcileResult(res, ctrl.Result{RequeueAfter: constants.WebSecretsResyncInterval}), nil
+}
+
+// Applies the Secret rendered from the web configuration, unless it already exists
+// for the same configuration, as hashed passwords differ every time they are rendered
+func (r *PushgatewayReconciler) reconcileWebSecret(pgw *monitoringv1alpha1.Pushgateway, desired *corev1.Secret, ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	found := &corev1.Secret{}
+
+	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, found)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		logger.Error(err, util.LogMessage(pgw, "Failed to get Secret"))
+		return ctrl.Result{}, err
+	}
+
+	hash := constants.WebConfigHashAnnotationName
+	if err == nil && found.Annotations[hash] == desired.Annotations[hash] {
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, r.applyObject(pgw, desired, ctx)
+}
+
+// Deletes the secrets rendered for a web configuration which has been removed
+func (r *PushgatewayReconciler) deleteWebConfig(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	if err := r.deleteStaleScrapeSecrets(pgw, "", ctx); err != nil {
+		return err
+	}
+	if err := r.deleteClientSecrets(pgw, ctx); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: resources.WebConfigSecretName(pgw), Namespace: pgw.Namespace}, secret)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if metav1.IsControlledBy(secret, pgw) {
+		return client.IgnoreNotFound(r.Delete(ctx, secret))
+	}
+	return nil
+}
+
+// Reconcile the persistent volume claim holding the pushgateway persistence file
+// Most of the claim spec is immutable, so only storage expansion is reconciled.
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;update;create;list;patch;watch;delete
+func (r *PushgatewayReconciler) reconcilePushgatewayPersistentVolumeClaim(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	found := &corev1.PersistentVolumeClaim{}
+	desired := resources.PushgatewayPersistentVolumeClaim(pgw)
+
+	err := r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: pgw.Namespace}, found)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		logger.Error(err, util.LogMessage(pgw, "Failed to get PersistentVolumeClaim"))
 		return ctrl.Result{}, err
 	}
 
-	// Check whether or not the service has been changed
-	// If it has changed, reconcile it
-	if !reflect.DeepEqual(desired.Spec, found.Spec) {
-		util.MergeMetadata(&desired.ObjectMeta, found.ObjectMeta)
-		return ctrl.Result{Requeue: true}, r.Update(ctx, desired)
+	// Claims cannot shrink, so a claim expanded beyond the desired size keeps its size
+	if err == nil {
+		desiredSize := desired.Spec.Resources.Requests[corev1.ResourceStorage]
+		foundSize := found.Spec.Resources.Requests[corev1.ResourceStorage]
+		if desiredSize.Cmp(foundSize) < 0 {
+			desired.Spec.Resources.Requests[corev1.ResourceStorage] = foundSize
+		}
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, r.applyObject(pgw, desired, ctx)
 }
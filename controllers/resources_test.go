@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+func TestApplyPatchKeepsEmptyObjectsSetThroughPointers(t *testing.T) {
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "pushgateway"}},
+					Volumes: []corev1.Volume{{
+						Name:         "scratch",
+						VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					}},
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+								TopologyKey:       "kubernetes.io/hostname",
+								NamespaceSelector: &metav1.LabelSelector{},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	patch, err := applyPatch(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(patch.Object, "spec", "template", "spec", "volumes")
+	if len(volumes) != 1 {
+		t.Fatalf("volumes = %v, want 1", volumes)
+	}
+	if emptyDir, ok := volumes[0].(map[string]interface{})["emptyDir"]; !ok || len(emptyDir.(map[string]interface{})) != 0 {
+		t.Errorf("volume = %v, want an empty emptyDir", volumes[0])
+	}
+
+	terms, _, _ := unstructured.NestedSlice(patch.Object, "spec", "template", "spec", "affinity", "podAntiAffinity", "requiredDuringSchedulingIgnoredDuringExecution")
+	if len(terms) != 1 {
+		t.Fatalf("anti-affinity terms = %v, want 1", terms)
+	}
+	if _, ok := terms[0].(map[string]interface{})["namespaceSelector"]; !ok {
+		t.Errorf("anti-affinity term = %v, want the namespace selector matching everything", terms[0])
+	}
+}
+
+func TestApplyPatchPrunesUnsetFields(t *testing.T) {
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "pushgateway"}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 1},
+	}
+
+	patch, err := applyPatch(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range [][]string{
+		{"status"},
+		{"metadata", "creationTimestamp"},
+		{"spec", "strategy"},
+		{"spec", "template", "metadata"},
+	} {
+		if _, found, _ := unstructured.NestedFieldNoCopy(patch.Object, path...); found {
+			t.Errorf("%v is applied", path)
+		}
+	}
+
+	containers, _, _ := unstructured.NestedSlice(patch.Object, "spec", "template", "spec", "containers")
+	if _, found := containers[0].(map[string]interface{})["resources"]; found {
+		t.Errorf("container = %v, want unset resources pruned", containers[0])
+	}
+	if name, _, _ := unstructured.NestedString(patch.Object, "metadata", "name"); name != "pushgateway" {
+		t.Errorf("name = %q, want pushgateway", name)
+	}
+}
+
+func TestApplyObject(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"}}
+	c := &applyRecorder{Client: newFakeClient(t)}
+	r := &PushgatewayReconciler{Client: c, Scheme: c.Scheme()}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "web", Port: 9091}}},
+		Status:     corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}}},
+	}
+	if err := r.applyObject(pgw, svc, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.applied) != 1 {
+		t.Fatalf("patches = %d, want 1", len(c.applied))
+	}
+	applied := c.applied[0]
+	if applied.GetAPIVersion() != "v1" || applied.GetKind() != "Service" {
+		t.Errorf("applied %s %s, want v1 Service", applied.GetAPIVersion(), applied.GetKind())
+	}
+	if _, ok := applied.Object["status"]; ok {
+		t.Errorf("applied status %v", applied.Object["status"])
+	}
+	if c.options.FieldManager != constants.FieldManager {
+		t.Errorf("field manager = %q, want %q", c.options.FieldManager, constants.FieldManager)
+	}
+	if c.options.Force == nil || !*c.options.Force {
+		t.Error("ownership of the applied fields is not forced")
+	}
+}
+
+func TestDeleteOwnedObject(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default", UID: "pgw-uid"}}
+	trueVar := true
+	owned := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:      "owned",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: "monitoring.coreos.com/v1alpha1", Kind: "Pushgateway", Name: "pushgateway", UID: "pgw-uid", Controller: &trueVar,
+		}},
+	}}
+	foreign := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "default"}}
+	r := &PushgatewayReconciler{Client: newFakeClient(t, owned, foreign)}
+
+	for _, name := range []string{"owned", "foreign", "missing"} {
+		if err := r.deleteOwnedObject(pgw, &appsv1.Deployment{}, name, context.Background()); err != nil {
+			t.Fatalf("deleteOwnedObject(%s) error = %v", name, err)
+		}
+	}
+
+	err := r.Get(context.Background(), types.NamespacedName{Name: "owned", Namespace: "default"}, &appsv1.Deployment{})
+	if !k8serrors.IsNotFound(err) {
+		t.Errorf("owned Deployment not deleted, error = %v", err)
+	}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "foreign", Namespace: "default"}, &appsv1.Deployment{}); err != nil {
+		t.Errorf("Deployment not controlled by the Pushgateway deleted, error = %v", err)
+	}
+}
+
+// applyRecorder records the apply patches, which the fake client does not support
+type applyRecorder struct {
+	client.Client
+	applied []*unstructured.Unstructured
+	options client.PatchOptions
+}
+
+func (c *applyRecorder) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	c.applied = append(c.applied, obj.(*unstructured.Unstructured))
+	c.options.ApplyOptions(opts)
+	return nil
+}
+
+func TestReconcilePushgatewayWorkloadRequiresProxyImage(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec: monitoringv1alpha1.PushgatewaySpec{
+			HighAvailability: &monitoringv1alpha1.PushgatewayHighAvailability{},
+		},
+	}
+	c := &applyRecorder{Client: newFakeClient(t)}
+	r := &PushgatewayReconciler{Client: c, Scheme: c.Scheme()}
+
+	if _, err := r.reconcilePushgatewayWorkload(pgw, context.Background()); err == nil {
+		t.Fatal("reconcilePushgatewayWorkload() without push proxy image succeeded")
+	}
+	if len(c.applied) != 0 {
+		t.Errorf("applied %d objects without push proxy image, want none", len(c.applied))
+	}
+
+	r.DefaultProxyImage = "registry.example.com/push-proxy:v0.1.0"
+	if _, err := r.reconcilePushgatewayWorkload(pgw, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, applied := range c.applied {
+		if applied.GetName() != resources.ProxyDeploymentName(pgw) {
+			continue
+		}
+		containers, _, _ := unstructured.NestedSlice(applied.Object, "spec", "template", "spec", "containers")
+		if len(containers) != 1 || containers[0].(map[string]interface{})["image"] != r.DefaultProxyImage {
+			t.Errorf("push proxy containers = %v, want the default image", containers)
+		}
+		return
+	}
+	t.Error("push proxy Deployment not applied")
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/injection"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Workloads whose injection is checked against their Pushgateway.
+// Pods are not listed, as they are not cached.
+func injectedWorkloads() []client.Object {
+	return []client.Object{
+		&batchv1.Job{},
+		&batchv1.CronJob{},
+		&appsv1.Deployment{},
+		&appsv1.StatefulSet{},
+		&appsv1.DaemonSet{},
+	}
+}
+
+func injectedWorkloadLists() []client.ObjectList {
+	return []client.ObjectList{
+		&batchv1.JobList{},
+		&batchv1.CronJobList{},
+		&appsv1.DeploymentList{},
+		&appsv1.StatefulSetList{},
+		&appsv1.DaemonSetList{},
+	}
+}
+
+// indexInjectedPushgateways indexes the workloads by the Pushgateway they were injected with,
+// so those of a Pushgateway are listed without going through every workload of the cluster
+func indexInjectedPushgateways(mgr ctrl.Manager) error {
+	for _, obj := range injectedWorkloads() {
+		err := mgr.GetFieldIndexer().IndexField(context.Background(), obj, constants.InjectedPushgatewayIndex, func(obj client.Object) []string {
+			if pgwName := injection.GetInjectedPushgateway(obj); pgwName != "" {
+				return []string{pgwName}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStaleWorkloads counts the workloads injected with the Pushgateway
+// which would be injected differently now. Finished Jobs don't push anymore.
+func (r *PushgatewayReconciler) updateStaleWorkloads(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	pgwName := fmt.Sprintf("%s/%s", pgw.Namespace, pgw.Name)
+
+	stale := int32(0)
+	for _, list := range injectedWorkloadLists() {
+		if err := r.List(ctx, list, client.MatchingFields{constants.InjectedPushgatewayIndex: pgwName}); err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+			if job, ok := obj.(*batchv1.Job); ok && jobFinishTime(job) != nil {
+				continue
+			}
+			if injection.IsStale(obj, pgw) {
+				stale++
+			}
+		}
+	}
+
+	pgw.Status.StaleWorkloads = stale
+	return nil
+}
+
+// watchInjectedWorkloads maps a workload to the Pushgateway it was injected with,
+// so its stale workloads are counted again
+func (r *PushgatewayReconciler) watchInjectedWorkloads(obj client.Object) []reconcile.Request {
+	namespace, name, err := cache.SplitMetaNamespaceKey(injection.GetInjectedPushgateway(obj))
+	if err != nil || name == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}},
+	}
+}
+
+// Only injected workloads whose spec or annotations changed can change the stale workloads
+// of their Pushgateway, or Jobs which finished, as they are not counted anymore
+var injectedWorkloadPredicate = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return injection.IsInjected(e.Object)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return injection.IsInjected(e.Object)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return injection.IsInjected(e.Object)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if !injection.IsInjected(e.ObjectOld) && !injection.IsInjected(e.ObjectNew) {
+			return false
+		}
+		return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+			!reflect.DeepEqual(e.ObjectOld.GetAnnotations(), e.ObjectNew.GetAnnotations()) ||
+			isFinishedJob(e.ObjectOld) != isFinishedJob(e.ObjectNew)
+	},
+}
+
+func isFinishedJob(obj client.Object) bool {
+	job, ok := obj.(*batchv1.Job)
+	return ok && jobFinishTime(job) != nil
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+)
+
+func TestUpdateStaleWorkloads(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "etl", Namespace: "jobs"}}
+	moved := pgw.DeepCopy()
+	moved.Spec.Port = 9092
+	moved.Spec.TelemetryPath = "/push"
+
+	running := newCleanupJob("running")
+	inject(t, running, pgw)
+	finished := newCleanupJob("finished")
+	inject(t, finished, pgw)
+	finished.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "jobs"},
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{Spec: newCleanupJob("").Spec},
+		},
+	}
+	inject(t, cronJob, pgw)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "jobs"},
+		Spec:       appsv1.DeploymentSpec{Template: newCleanupJob("").Spec.Template},
+	}
+	inject(t, deployment, moved)
+
+	// The fake client ignores the field index, so only workloads of the Pushgateway are listed
+	r := &PushgatewayReconciler{Client: newFakeClient(t, running, finished, cronJob, deployment)}
+	if err := r.updateStaleWorkloads(moved, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if moved.Status.StaleWorkloads != 2 {
+		t.Errorf("stale workloads = %d, want 2", moved.Status.StaleWorkloads)
+	}
+}
+
+func TestWatchInjectedWorkloads(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "etl", Namespace: "jobs"}}
+	injected := newCleanupJob("injected")
+	inject(t, injected, pgw)
+
+	r := &PushgatewayReconciler{}
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "etl", Namespace: "jobs"}}}
+	if got := r.watchInjectedWorkloads(injected); !reflect.DeepEqual(got, want) {
+		t.Errorf("watchInjectedWorkloads() = %v, want %v", got, want)
+	}
+	if got := r.watchInjectedWorkloads(newCleanupJob("other")); got != nil {
+		t.Errorf("watchInjectedWorkloads() of a Job which is not injected = %v, want nil", got)
+	}
+}
+
+func TestInjectedWorkloadPredicate(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "etl", Namespace: "jobs"}}
+	injected := newCleanupJob("injected")
+	inject(t, injected, pgw)
+
+	relabeled := injected.DeepCopy()
+	relabeled.Labels = map[string]string{"team": "data"}
+	respecced := injected.DeepCopy()
+	respecced.Generation++
+	finished := injected.DeepCopy()
+	finished.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+	uninjected := newCleanupJob("injected")
+
+	tests := []struct {
+		name string
+		old  *batchv1.Job
+		new  *batchv1.Job
+		want bool
+	}{
+		{name: "labels changed", old: injected, new: relabeled, want: false},
+		{name: "spec changed", old: injected, new: respecced, want: true},
+		{name: "finished", old: injected, new: finished, want: true},
+		{name: "uninjected", old: injected, new: uninjected, want: true},
+		{name: "not injected", old: uninjected, new: uninjected, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectedWorkloadPredicate.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new}); got != tt.want {
+				t.Errorf("Update() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	if !injectedWorkloadPredicate.Create(event.CreateEvent{Object: injected}) {
+		t.Error("Create() of an injected Job = false, want true")
+	}
+	if injectedWorkloadPredicate.Create(event.CreateEvent{Object: uninjected}) {
+		t.Error("Create() of a Job which is not injected = true, want false")
+	}
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// setCondition sets a condition on the Pushgateway status for its current generation
+func setCondition(pgw *monitoringv1alpha1.Pushgateway, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&pgw.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: pgw.Generation,
+	})
+}
+
+// setDegraded marks the Pushgateway as degraded and not ready because of err
+func setDegraded(pgw *monitoringv1alpha1.Pushgateway, reason string, err error) {
+	setCondition(pgw, monitoringv1alpha1.ConditionDegraded, metav1.ConditionTrue, reason, err.Error())
+	setCondition(pgw, monitoringv1alpha1.ConditionReady, metav1.ConditionFalse, reason, err.Error())
+}
+
+// updateWorkloadStatus copies the replica counts and availability of the
+// Pushgateway Deployment, or StatefulSet when sharded or highly available, to the Pushgateway status
+func (r *PushgatewayReconciler) updateWorkloadStatus(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	if resources.IsHighlyAvailable(pgw) {
+		return r.updateHighAvailabilityStatus(pgw, ctx)
+	}
+	if resources.IsSharded(pgw) {
+		return r.updateStatefulSetStatus(pgw, ctx)
+	}
+	return r.updateDeploymentStatus(pgw, ctx)
+}
+
+// updateDeploymentStatus copies the replica counts and availability of the
+// Pushgateway Deployment to the Pushgateway status
+func (r *PushgatewayReconciler) updateDeploymentStatus(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	dep := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: resources.DeploymentName(pgw), Namespace: pgw.Namespace}, dep)
+	if err != nil {
+		return err
+	}
+
+	pgw.Status.Replicas = 0
+	if dep.Spec.Replicas != nil {
+		pgw.Status.Replicas = *dep.Spec.Replicas
+	}
+	pgw.Status.ReadyReplicas = dep.Status.ReadyReplicas
+	pgw.Status.AvailableReplicas = dep.Status.AvailableReplicas
+
+	for _, condition := range dep.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable {
+			status, reason := metav1.ConditionFalse, constants.ReasonDeploymentUnavailable
+			if condition.Status == corev1.ConditionTrue {
+				status, reason = metav1.ConditionTrue, constants.ReasonDeploymentAvailable
+			}
+			// Conditions require a reason, which the Deployment controller may leave empty
+			if condition.Reason != "" {
+				reason = condition.Reason
+			}
+			setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, status, reason, condition.Message)
+			return nil
+		}
+	}
+
+	// The Deployment controller hasn't reported availability yet
+	setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, metav1.ConditionUnknown,
+		constants.ReasonDeploymentPending, "Waiting for the Deployment to report availability")
+	return nil
+}
+
+// updateStatefulSetStatus copies the replica counts of the Pushgateway StatefulSet
+// to the Pushgateway status. Pushes to a shard fail while it is down,
+// so the Pushgateway is only available once every shard is ready.
+func (r *PushgatewayReconciler) updateStatefulSetStatus(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	sts := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: resources.StatefulSetName(pgw), Namespace: pgw.Namespace}, sts)
+	if err != nil {
+		return err
+	}
+
+	pgw.Status.Replicas = 0
+	if sts.Spec.Replicas != nil {
+		pgw.Status.Replicas = *sts.Spec.Replicas
+	}
+	pgw.Status.ReadyReplicas = sts.Status.ReadyReplicas
+	pgw.Status.AvailableReplicas = sts.Status.ReadyReplicas
+
+	if pgw.Status.ReadyReplicas < pgw.Status.Replicas {
+		setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, metav1.ConditionFalse, constants.ReasonShardsUnavailable,
+			fmt.Sprintf("%d of %d shards are ready", pgw.Status.ReadyReplicas, pgw.Status.Replicas))
+		return nil
+	}
+
+	setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, metav1.ConditionTrue, constants.ReasonShardsReady,
+		fmt.Sprintf("All %d shards are ready", pgw.Status.Replicas))
+	return nil
+}
+
+// updateHighAvailabilityStatus copies the replica counts of the Pushgateway StatefulSet
+// to the Pushgateway status. Pushes are accepted as long as the push proxy
+// is available and a single replica is ready.
+func (r *PushgatewayReconciler) updateHighAvailabilityStatus(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	sts := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: resources.StatefulSetName(pgw), Namespace: pgw.Namespace}, sts)
+	if err != nil {
+		return err
+	}
+
+	pgw.Status.Replicas = 0
+	if sts.Spec.Replicas != nil {
+		pgw.Status.Replicas = *sts.Spec.Replicas
+	}
+	pgw.Status.ReadyReplicas = sts.Status.ReadyReplicas
+	pgw.Status.AvailableReplicas = sts.Status.ReadyReplicas
+
+	proxy := &appsv1.Deployment{}
+	err = r.Get(ctx, types.NamespacedName{Name: resources.ProxyDeploymentName(pgw), Namespace: pgw.Namespace}, proxy)
+	if err != nil {
+		return err
+	}
+
+	if proxy.Status.AvailableReplicas == 0 {
+		setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, metav1.ConditionFalse, constants.ReasonReplicasUnavailable,
+			"Push proxy is not available")
+		return nil
+	}
+	if pgw.Status.ReadyReplicas == 0 {
+		setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, metav1.ConditionFalse, constants.ReasonReplicasUnavailable,
+			"No replica is ready")
+		return nil
+	}
+
+	setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, metav1.ConditionTrue, constants.ReasonReplicasAvailable,
+		fmt.Sprintf("%d of %d replicas are ready behind the push proxy", pgw.Status.ReadyReplicas, pgw.Status.Replicas))
+	return nil
+}
+
+// setReady sets the Ready condition according to the other conditions.
+// The Pushgateway is ready once its workload is available and nothing is degraded.
+func setReady(pgw *monitoringv1alpha1.Pushgateway) {
+	if meta.IsStatusConditionTrue(pgw.Status.Conditions, monitoringv1alpha1.ConditionDegraded) {
+		return
+	}
+
+	available := meta.FindStatusCondition(pgw.Status.Conditions, monitoringv1alpha1.ConditionDeploymentAvailable)
+	if available == nil || available.Status != metav1.ConditionTrue {
+		reason := constants.ReasonDeploymentUnavailable
+		if available != nil && available.Status == metav1.ConditionFalse {
+			reason = available.Reason
+		}
+		setCondition(pgw, monitoringv1alpha1.ConditionReady, metav1.ConditionFalse,
+			reason, fmt.Sprintf("Pushgateway %s is not available", workloadKind(pgw)))
+		return
+	}
+
+	setCondition(pgw, monitoringv1alpha1.ConditionReady, metav1.ConditionTrue,
+		constants.ReasonReconciled, "Pushgateway is ready")
+}
+
+// Returns the kind of the workload running the Pushgateway
+func workloadKind(pgw *monitoringv1alpha1.Pushgateway) string {
+	if resources.IsSharded(pgw) || resources.IsHighlyAvailable(pgw) {
+		return "StatefulSet"
+	}
+	return "Deployment"
+}
+
+// updateStatus writes the Pushgateway status for its current generation.
+// Only the fields set by the reconciler are patched, the expired metric groups
+// are reported concurrently by the MetricRetentionRunner.
+func (r *PushgatewayReconciler) updateStatus(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	pgw.Status.ObservedGeneration = pgw.Generation
+
+	latest := &monitoringv1alpha1.Pushgateway{}
+	if err := r.Get(ctx, types.NamespacedName{Name: pgw.Name, Namespace: pgw.Namespace}, latest); err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to get Pushgateway to update its status"))
+		return err
+	}
+	pgw.Status.ExpiredMetricGroups = latest.Status.ExpiredMetricGroups
+	pgw.Status.LastMetricExpirationTime = latest.Status.LastMetricExpirationTime
+
+	patched := latest.DeepCopy()
+	patched.Status = pgw.Status
+	err := r.Status().Patch(ctx, patched, client.MergeFrom(latest))
+	if err != nil {
+		logger.Error(err, util.LogMessage(pgw, "Failed to update status"))
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+func TestSetReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        monitoringv1alpha1.PushgatewaySpec
+		available   *metav1.Condition
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+		wantMessage string
+	}{
+		{
+			name:        "Deployment pending",
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  constants.ReasonDeploymentUnavailable,
+			wantMessage: "Pushgateway Deployment is not available",
+		},
+		{
+			name:        "Deployment unavailable",
+			available:   &metav1.Condition{Status: metav1.ConditionFalse, Reason: "MinimumReplicasUnavailable"},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  "MinimumReplicasUnavailable",
+			wantMessage: "Pushgateway Deployment is not available",
+		},
+		{
+			name:        "shards unavailable",
+			spec:        monitoringv1alpha1.PushgatewaySpec{Sharding: &monitoringv1alpha1.PushgatewaySharding{Shards: 2}},
+			available:   &metav1.Condition{Status: metav1.ConditionFalse, Reason: constants.ReasonShardsUnavailable},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  constants.ReasonShardsUnavailable,
+			wantMessage: "Pushgateway StatefulSet is not available",
+		},
+		{
+			name:        "replicas unavailable",
+			spec:        monitoringv1alpha1.PushgatewaySpec{HighAvailability: &monitoringv1alpha1.PushgatewayHighAvailability{}},
+			available:   &metav1.Condition{Status: metav1.ConditionFalse, Reason: constants.ReasonReplicasUnavailable},
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  constants.ReasonReplicasUnavailable,
+			wantMessage: "Pushgateway StatefulSet is not available",
+		},
+		{
+			name:        "available",
+			available:   &metav1.Condition{Status: metav1.ConditionTrue, Reason: constants.ReasonDeploymentAvailable},
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  constants.ReasonReconciled,
+			wantMessage: "Pushgateway is ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := &monitoringv1alpha1.Pushgateway{Spec: tt.spec}
+			if tt.available != nil {
+				setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, tt.available.Status, tt.available.Reason, "")
+			}
+
+			setReady(pgw)
+
+			ready := meta.FindStatusCondition(pgw.Status.Conditions, monitoringv1alpha1.ConditionReady)
+			if ready == nil {
+				t.Fatal("Ready condition not set")
+			}
+			if ready.Status != tt.wantStatus || ready.Reason != tt.wantReason || ready.Message != tt.wantMessage {
+				t.Errorf("Ready = %s, %s, %q, want %s, %s, %q",
+					ready.Status, ready.Reason, ready.Message, tt.wantStatus, tt.wantReason, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestSetReadyDegraded(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{}
+	setCondition(pgw, monitoringv1alpha1.ConditionDeploymentAvailable, metav1.ConditionTrue, constants.ReasonDeploymentAvailable, "")
+	setDegraded(pgw, "Failed", errors.New("failed"))
+
+	setReady(pgw)
+
+	if meta.IsStatusConditionTrue(pgw.Status.Conditions, monitoringv1alpha1.ConditionReady) {
+		t.Error("degraded Pushgateway reported ready")
+	}
+}
+
+func TestUpdateDeploymentStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []appsv1.DeploymentCondition
+		wantStatus metav1.ConditionStatus
+		wantReason string
+	}{
+		{
+			name:       "no condition yet",
+			wantStatus: metav1.ConditionUnknown,
+			wantReason: constants.ReasonDeploymentPending,
+		},
+		{
+			name: "available",
+			conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue, Reason: "MinimumReplicasAvailable"},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: "MinimumReplicasAvailable",
+		},
+		{
+			name: "unavailable without reason",
+			conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse},
+			},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: constants.ReasonDeploymentUnavailable,
+		},
+		{
+			name: "available without reason",
+			conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "NewReplicaSetAvailable"},
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: constants.ReasonDeploymentAvailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"}}
+			replicas := int32(2)
+			dep := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: resources.DeploymentName(pgw), Namespace: "default"},
+				Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+				Status: appsv1.DeploymentStatus{
+					ReadyReplicas:     2,
+					AvailableReplicas: 1,
+					Conditions:        tt.conditions,
+				},
+			}
+			r := &PushgatewayReconciler{Client: fake.NewClientBuilder().WithObjects(dep).Build()}
+
+			if err := r.updateDeploymentStatus(pgw, context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if pgw.Status.Replicas != 2 || pgw.Status.ReadyReplicas != 2 || pgw.Status.AvailableReplicas != 1 {
+				t.Errorf("replicas = %d/%d/%d, want 2/2/1", pgw.Status.Replicas, pgw.Status.ReadyReplicas, pgw.Status.AvailableReplicas)
+			}
+			available := meta.FindStatusCondition(pgw.Status.Conditions, monitoringv1alpha1.ConditionDeploymentAvailable)
+			if available == nil || available.Status != tt.wantStatus || available.Reason != tt.wantReason {
+				t.Errorf("DeploymentAvailable = %+v, want %s, %s", available, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusObservedGeneration(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := monitoringv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default", Generation: 3}}
+	r := &PushgatewayReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(pgw).Build()}
+
+	if err := r.updateStatus(pgw, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &monitoringv1alpha1.Pushgateway{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "pushgateway", Namespace: "default"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.ObservedGeneration != 3 {
+		t.Errorf("observedGeneration = %d, want 3", got.Status.ObservedGeneration)
+	}
+}
+
+func TestUpdateStatusKeepsExpiredMetricGroups(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := monitoringv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	stored := &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default", Generation: 2},
+		Status:     monitoringv1alpha1.PushgatewayStatus{ExpiredMetricGroups: 3},
+	}
+	r := &PushgatewayReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(stored).Build()}
+
+	// Read before the runner reported the expired metric groups
+	pgw := stored.DeepCopy()
+	pgw.Status = monitoringv1alpha1.PushgatewayStatus{Prometheus: "monitoring/k8s"}
+
+	if err := r.updateStatus(pgw, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &monitoringv1alpha1.Pushgateway{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "pushgateway", Namespace: "default"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.ExpiredMetricGroups != 3 {
+		t.Errorf("expiredMetricGroups = %d, want 3", got.Status.ExpiredMetricGroups)
+	}
+	if got.Status.Prometheus != "monitoring/k8s" || got.Status.ObservedGeneration != 2 {
+		t.Errorf("status = %+v, want the reconciled fields", got.Status)
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+// GetWebCredentials reads the basic authentication users and the CA certificate
+// referenced by the Pushgateway web configuration. Referenced Secrets are not
+// labeled by the operator, so they must be read through an uncached reader.
+func GetWebCredentials(c client.Reader, pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) (*resources.WebCredentials, error) {
+	creds := &resources.WebCredentials{}
+	web := pgw.Spec.Web
+
+	// Generated values are kept from the rendered web configuration
+	rendered := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: resources.WebConfigSecretName(pgw), Namespace: pgw.Namespace}, rendered)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if web.BasicAuthUsers != nil {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: web.BasicAuthUsers.Name, Namespace: pgw.Namespace}, secret); err != nil {
+			return nil, err
+		}
+		if len(secret.Data) == 0 {
+			return nil, fmt.Errorf("basic authentication users Secret %s/%s is empty", pgw.Namespace, web.BasicAuthUsers.Name)
+		}
+		creds.Users = secret.Data
+
+		if _, ok := creds.Users[constants.WebPushUsername]; ok {
+			return nil, fmt.Errorf("user %s of Secret %s/%s is reserved for injected workloads", constants.WebPushUsername, pgw.Namespace, web.BasicAuthUsers.Name)
+		}
+		if user := resources.GetScrapeUser(pgw, creds); creds.Users[user] == nil {
+			return nil, fmt.Errorf("scrape user %s not found in Secret %s/%s", user, pgw.Namespace, web.BasicAuthUsers.Name)
+		}
+
+		pushPassword, err := getGeneratedValue(rendered, constants.WebPushPasswordKey, constants.WebPushPasswordLength)
+		if err != nil {
+			return nil, err
+		}
+		creds.PushPassword = pushPassword
+	}
+
+	if web.TLS != nil && web.TLS.CA != nil {
+		ca, err := getSecretKey(c, pgw.Namespace, *web.TLS.CA, ctx)
+		if err != nil {
+			return nil, err
+		}
+		creds.CA = ca
+	}
+
+	salt, err := getGeneratedValue(rendered, constants.WebConfigSaltKey, constants.WebConfigSaltLength)
+	if err != nil {
+		return nil, err
+	}
+	creds.Salt = salt
+
+	return creds, nil
+}
+
+// getGeneratedValue returns the value generated by the operator from the rendered
+// web configuration, or generates it before it is first rendered
+func getGeneratedValue(rendered *corev1.Secret, key string, length int) ([]byte, error) {
+	if value, ok := rendered.Data[key]; ok && len(value) > 0 {
+		return value, nil
+	}
+
+	random := make([]byte, length)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(random)), nil
+}
+
+func getSecretKey(c client.Reader, namespace string, selector corev1.SecretKeySelector, ctx context.Context) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: selector.Name, Namespace: namespace}, secret); err != nil {
+		return nil, err
+	}
+
+	data, ok := secret.Data[selector.Key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in Secret %s/%s", selector.Key, namespace, selector.Name)
+	}
+	return data, nil
+}
+
+// getMonitorNamespace returns the namespace the monitor of the Pushgateway is in,
+// or an empty string if it has none
+func getMonitorNamespace(pgw *monitoringv1alpha1.Pushgateway) string {
+	switch resources.GetMonitorTypeOrDefault(pgw) {
+	case monitoringv1alpha1.MonitorTypeServiceMonitor:
+		return resources.ServiceMonitorNamespace(pgw)
+	case monitoringv1alpha1.MonitorTypePodMonitor:
+		return resources.PodMonitorNamespace(pgw)
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+func TestGetWebCredentials(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec: monitoringv1alpha1.PushgatewaySpec{
+			Web: &monitoringv1alpha1.PushgatewayWeb{
+				BasicAuthUsers: &corev1.LocalObjectReference{Name: "users"},
+			},
+		},
+	}
+	users := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "default"},
+		Data:       map[string][]byte{"alice": []byte("alice-password")},
+	}
+
+	// Generated before the web configuration is first rendered
+	creds, err := GetWebCredentials(newFakeClient(t, users), pgw, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds.PushPassword) == 0 || len(creds.Salt) == 0 {
+		t.Fatalf("credentials = %+v, want a generated push password and salt", creds)
+	}
+	if string(creds.Users["alice"]) != "alice-password" {
+		t.Errorf("users = %q, want alice", creds.Users)
+	}
+
+	// Kept once rendered
+	rendered, err := resources.PushgatewayWebConfigSecret(pgw, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := GetWebCredentials(newFakeClient(t, users, rendered), pgw, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again.PushPassword) != string(creds.PushPassword) || string(again.Salt) != string(creds.Salt) {
+		t.Error("generated push password and salt were not kept")
+	}
+	if resources.WebConfigHash(pgw, again) != rendered.Annotations[constants.WebConfigHashAnnotationName] {
+		t.Error("hash changed while the web configuration did not")
+	}
+}
+
+func TestGetWebCredentialsReservedUser(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec: monitoringv1alpha1.PushgatewaySpec{
+			Web: &monitoringv1alpha1.PushgatewayWeb{
+				BasicAuthUsers: &corev1.LocalObjectReference{Name: "users"},
+			},
+		},
+	}
+	users := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "users", Namespace: "default"},
+		Data:       map[string][]byte{constants.WebPushUsername: []byte("password")},
+	}
+
+	if _, err := GetWebCredentials(newFakeClient(t, users), pgw, context.Background()); err == nil {
+		t.Error("GetWebCredentials() with the reserved push user should fail")
+	}
+}
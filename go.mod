@@ -8,14 +8,16 @@ require (
 	github.com/cpuguy83/go-md2man v1.0.10 // indirect
 	github.com/docker/docker v0.7.3-0.20190327010347-be7ac8be2ae0 // indirect
 	github.com/docker/spdystream v0.0.0-20160310174837-449fdfce4d96 // indirect
-	github.com/go-logr/logr v0.4.0 // indirect
+	github.com/go-logr/logr v0.4.0
 	github.com/go-openapi/validate v0.19.5 // indirect
 	github.com/gophercloud/gophercloud v0.1.0 // indirect
 	github.com/onsi/ginkgo v1.16.4
 	github.com/onsi/gomega v1.13.0
 	github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring v0.52.1
+	github.com/prometheus/client_golang v1.11.0
 	github.com/ugorji/go/codec v0.0.0-20181204163529-d75b2dcb6bc8 // indirect
 	github.com/xordataexchange/crypt v0.0.3-0.20170626215501-b2862e3d0a77 // indirect
+	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
 	gotest.tools v2.2.0+incompatible // indirect
 	k8s.io/api v0.22.3
 	k8s.io/apimachinery v0.22.3
@@ -23,4 +25,5 @@ require (
 	k8s.io/klog v1.0.0 // indirect
 	sigs.k8s.io/controller-runtime v0.9.2
 	sigs.k8s.io/structured-merge-diff/v3 v3.0.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
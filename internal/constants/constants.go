@@ -1,12 +1,25 @@
 package constants
 
+import "time"
+
 // Naming conventions
 const (
 	ContainerName        = "pushgateway"
+	ProxyContainerName   = "push-proxy"
 	DeploymentSuffix     = "-pushgateway"
+	StatefulSetSuffix    = "-pushgateway"
+	ProxySuffix          = "-pushgateway-proxy"
+	ReplicasSuffix       = "-pushgateway-replicas"
 	ServiceSuffix        = "-pushgateway"
 	ServiceMonitorSuffix = "-pushgateway"
+	PodMonitorSuffix     = "-pushgateway"
+	PVCSuffix            = "-pushgateway"
+	WebConfigSuffix      = "-pushgateway-web-config"
+	ScrapeSecretSuffix   = "-pushgateway-scrape"
+	ClientSecretSuffix   = "-pushgateway-client"
 	PortName             = "web"
+	FieldManager         = "pushgateway-operator"
+	NotInLabelValue      = "pushgateway" // Monitor label value for NotIn Prometheus selectors
 )
 
 // Default values
@@ -14,6 +27,46 @@ const (
 	DefaultPort          = 9091
 	DefaultTelemetryPath = "/metrics"
 	DefaultImage         = "prom/pushgateway"
+	DefaultLogLevel      = "info"
+	DefaultLogFormat     = "logfmt"
+)
+
+// Security context
+const (
+	RunAsUser = 65534 // nobody, the user the default image runs as
+)
+
+// Persistence
+const (
+	PersistenceVolumeName  = "storage"
+	PersistenceMountPath   = "/data"
+	PersistenceFile        = "/data/metrics"
+	PersistenceFSGroup     = RunAsUser
+	DefaultPersistenceSize = "1Gi"
+)
+
+// Web configuration
+const (
+	WebConfigVolumeName         = "web-config"
+	WebConfigMountPath          = "/etc/pushgateway/web"
+	WebConfigKey                = "web-config.yml"
+	WebCertKey                  = "tls.crt"
+	WebKeyKey                   = "tls.key"
+	WebCAKey                    = "ca.crt"
+	WebUsernameKey              = "username"
+	WebPasswordKey              = "password"
+	WebPushUsernameKey          = "push-username"
+	WebPushPasswordKey          = "push-password"
+	WebPushUsername             = "pushgateway-push" // User injected workloads push as
+	WebPushPasswordLength       = 32
+	WebConfigSaltKey            = "web-config-salt" // Salt of the web configuration hash, never copied out of the Pushgateway namespace
+	WebConfigSaltLength         = 32
+	WebConfigHashAnnotationName = "pushgateway.monitoring.coreos.com/web-config-hash"
+	WebSecretsResyncInterval    = time.Minute // Referenced Secrets are not watched, they are read again this often
+	SecretTypeLabelName         = "pushgateway.monitoring.coreos.com/secret"
+	SecretTypeWebConfig         = "web-config"
+	SecretTypeScrape            = "scrape"
+	SecretTypeClient            = "client"
 )
 
 // Image arguments
@@ -24,6 +77,17 @@ const (
 	TelemetryPathArg   = "--web.telemetry-path="
 	LogLevelArg        = "--log.level="
 	LogFormatArg       = "--log.format="
+	PersistenceFileArg = "--persistence.file="
+	PersistenceIntArg  = "--persistence.interval="
+	WebConfigFileArg   = "--web.config.file="
+)
+
+// Push proxy arguments and endpoints
+const (
+	ProxyListenAddressArg = "--listen-address="
+	ProxyUpstreamsArg     = "--upstreams="
+	ProxyHealthyPath      = "/-/healthy"
+	ProxyReadyPath        = "/-/ready"
 )
 
 // k8s resources names
@@ -31,17 +95,105 @@ const (
 	ResourceDeployment     = "Deployment"
 	ResourceService        = "Service"
 	ResourceServiceMonitor = "ServiceMonitor"
+	ResourcePVC            = "PersistentVolumeClaim"
+	ResourceSecret         = "Secret"
+)
+
+const (
+	JOB_WAIT_TIME_SECONDS        = 10 // Wait for 10 seconds before trying to create Job again
+	JOB_CREATION_TIMEOUT_SECONDS = 6  // Timeout after 1 min
+)
+
+// Condition reasons
+const (
+	ReasonReconciled            = "Reconciled"
+	ReasonReconcileFailed       = "ReconcileFailed"
+	ReasonPrometheusFound       = "PrometheusFound"
+	ReasonPrometheusNotFound    = "PrometheusNotFound"
+	ReasonDeploymentPending     = "DeploymentPending"
+	ReasonDeploymentAvailable   = "DeploymentAvailable"
+	ReasonDeploymentUnavailable = "DeploymentUnavailable"
+	ReasonShardsReady           = "ShardsReady"
+	ReasonShardsUnavailable     = "ShardsUnavailable"
+	ReasonReplicasAvailable     = "ReplicasAvailable"
+	ReasonReplicasUnavailable   = "ReplicasUnavailable"
+)
+
+// Used to track resources which cannot be owned by the Pushgateway,
+// such as ServiceMonitors in other namespaces
+const (
+	PushgatewayFinalizer    = "pushgateway.monitoring.coreos.com/finalizer"
+	OwnerNameLabelName      = "pushgateway.monitoring.coreos.com/name"
+	OwnerNamespaceLabelName = "pushgateway.monitoring.coreos.com/namespace"
+)
+
+const (
+	PushgatewayEnvVar         = "PUSHGATEWAY"
+	PushgatewayUsernameEnvVar = "PUSHGATEWAY_USERNAME"
+	PushgatewayPasswordEnvVar = "PUSHGATEWAY_PASSWORD"
+	PushgatewayCAFileEnvVar   = "PUSHGATEWAY_CA_FILE"
+	PushgatewayCAVolumeName   = "pushgateway-ca"
+	PushgatewayCAMountPath    = "/etc/pushgateway/ca"
+	PushgatewayPodNameEnvVar  = "PUSHGATEWAY_POD_NAME"
+	PushgatewayRunEnvVar      = "PUSHGATEWAY_RUN"
+	JobNamePodLabelName       = "job-name"
+	CronJobGroupingKeyLabel   = "cronjob"
+	DefaultGroupingKeyPrefix  = "PUSHGATEWAY_LABEL_"
+	DefaultGroupingKeyJob     = "{{.Name}}"
+	PushgatewayLabelName      = "inject-pushgateway"
+	// Names the Pushgateway to inject, when it cannot be set as the label value.
+	// Pushgateways in other namespaces are named as namespace/name.
+	PushgatewayAnnotationName = "pushgateway.monitoring.coreos.com/pushgateway"
+	// Comma separated names of the containers, init containers and ephemeral
+	// containers to inject. All containers are injected if omitted. Ephemeral
+	// containers are only injected in bare pods which were injected when created,
+	// with the same Pushgateway. They are not recorded, so never uninjected.
+	ContainersAnnotationName = "pushgateway.monitoring.coreos.com/containers"
+	// Injects init containers as well, when containers are not named
+	InitContainersAnnotationName = "pushgateway.monitoring.coreos.com/init-containers"
+	// Records what was injected into a workload, so it can be reversed
+	InjectedAnnotationName = "pushgateway.monitoring.coreos.com/injected"
+	// Field index of the workloads by the Pushgateway they were injected with
+	InjectedPushgatewayIndex = "injectedPushgateway"
+	// Opts a workload out of injection, in namespaces injected by default
+	PushgatewayLabelDisabledValue = "false"
+	// Jobs and CronJobs of namespaces labeled enabled are injected
+	// with the default Pushgateway, unless they opt out
+	NamespaceInjectionLabelName    = "pushgateway.monitoring.coreos.com/inject"
+	NamespaceInjectionEnabledValue = "enabled"
+)
+
+// Label values injecting the default Pushgateway of the namespace,
+// rather than naming a Pushgateway
+func PushgatewayLabelDefaultValues() []string {
+	return []string{"", "true", "yes"}
+}
+
+// Event reasons
+const (
+	EventReasonInjected             = "Injected"
+	EventReasonInjectionFailed      = "InjectionFailed"
+	EventReasonInjectionRemoved     = "InjectionRemoved"
+	EventReasonMetricsDeleted       = "MetricsDeleted"
+	EventReasonMetricsCleanupFailed = "MetricsCleanupFailed"
 )
 
+// Job metrics cleanup
 const (
-	SERVICE_MONITOR_MAX_REPEAT   = 100 //To avoid infinite looping
-	JOB_WAIT_TIME_SECONDS        = 10  // Wait for 10 seconds before trying to create Job again
-	JOB_CREATION_TIMEOUT_SECONDS = 6   // Timeout after 1 min
+	JobCleanupFinalizer        = "pushgateway.monitoring.coreos.com/metrics-cleanup"
+	JobCleanedUpAnnotationName = "pushgateway.monitoring.coreos.com/metrics-deleted"
+	DefaultJobCleanupRetention = 5 * time.Minute
+	JobCleanupDeletionTimeout  = 10 * time.Minute // Release deleted Jobs even if their metrics could not be deleted
+	PushgatewayMetricsAPIPath  = "/api/v1/metrics"
+	PushgatewayWipeAPIPath     = "/api/v1/admin/wipe"
+	PushgatewayClientTimeout   = 10 // seconds
 )
 
+// Distinguishes the Pushgateway replicas from the push proxy in high availability mode
 const (
-	PushgatewayEnvVar    = "PUSHGATEWAY"
-	PushgatewayLabelName = "inject-pushgateway"
+	ComponentLabelName = "app.kubernetes.io/component"
+	ComponentReplica   = "pushgateway"
+	ComponentProxy     = "push-proxy"
 )
 
 func PushgatewayLabels() map[string]string {
@@ -0,0 +1,58 @@
+package injection
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+type containerKind int
+
+const (
+	containerKindRegular containerKind = iota
+	containerKindInit
+	containerKindEphemeral
+)
+
+// containerSelector selects the containers of a pod spec to inject,
+// according to the annotations of the workload or pod
+type containerSelector struct {
+	names          map[string]bool
+	initContainers bool
+}
+
+func newContainerSelector(obj metav1.Object) *containerSelector {
+	annotations := obj.GetAnnotations()
+	selector := &containerSelector{
+		initContainers: annotations[constants.InitContainersAnnotationName] == "true",
+	}
+
+	if value := annotations[constants.ContainersAnnotationName]; value != "" {
+		selector.names = map[string]bool{}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				selector.names[name] = true
+			}
+		}
+	}
+	return selector
+}
+
+// Named containers are selected whatever their kind. Otherwise, all
+// containers are selected, init containers only when asked for,
+// and ephemeral containers never.
+func (s *containerSelector) selects(name string, kind containerKind) bool {
+	if s.names != nil {
+		return s.names[name]
+	}
+
+	switch kind {
+	case containerKindRegular:
+		return true
+	case containerKindInit:
+		return s.initContainers
+	}
+	return false
+}
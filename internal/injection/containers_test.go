@@ -0,0 +1,142 @@
+package injection
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestContainerSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        map[containerKind][]string
+	}{
+		{
+			name: "default",
+			want: map[containerKind][]string{containerKindRegular: {"main", "debug"}},
+		},
+		{
+			name:        "init containers",
+			annotations: map[string]string{constants.InitContainersAnnotationName: "true"},
+			want: map[containerKind][]string{
+				containerKindRegular: {"main", "debug"},
+				containerKindInit:    {"main", "debug"},
+			},
+		},
+		{
+			name:        "named",
+			annotations: map[string]string{constants.ContainersAnnotationName: " main, ,"},
+			want: map[containerKind][]string{
+				containerKindRegular:   {"main"},
+				containerKindInit:      {"main"},
+				containerKindEphemeral: {"main"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := newContainerSelector(&metav1.ObjectMeta{Annotations: tt.annotations})
+			for _, kind := range []containerKind{containerKindRegular, containerKindInit, containerKindEphemeral} {
+				got := []string{}
+				for _, name := range []string{"main", "debug"} {
+					if selector.selects(name, kind) {
+						got = append(got, name)
+					}
+				}
+				want := tt.want[kind]
+				if want == nil {
+					want = []string{}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("selected containers of kind %d = %v, want %v", kind, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInjectSelectedContainers(t *testing.T) {
+	pgw := newInjectingPushgateway(nil)
+	job := newInjectableJob()
+	job.Annotations = map[string]string{constants.ContainersAnnotationName: "backup,init"}
+	job.Spec.Template.Spec.Containers = append(job.Spec.Template.Spec.Containers,
+		// Already holds the variable, and is not selected
+		corev1.Container{Name: "exporter", Env: []corev1.EnvVar{{Name: constants.PushgatewayEnvVar, Value: "http://elsewhere"}}},
+	)
+	untouched := job.Spec.Template.Spec.Containers[1].DeepCopy()
+
+	if _, err := Inject(job, pgw); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := job.Spec.Template.Spec
+	if len(spec.Containers) != 2 || len(spec.InitContainers) != 1 {
+		t.Fatalf("containers = %d, init containers = %d, want 2 and 1", len(spec.Containers), len(spec.InitContainers))
+	}
+	if !hasEnvVar(spec.Containers[0].Env, constants.PushgatewayEnvVar) {
+		t.Error("backup container not injected")
+	}
+	if !hasEnvVar(spec.InitContainers[0].Env, constants.PushgatewayEnvVar) {
+		t.Error("named init container not injected")
+	}
+	if !reflect.DeepEqual(&spec.Containers[1], untouched) {
+		t.Errorf("exporter container = %+v, want untouched %+v", spec.Containers[1], *untouched)
+	}
+
+	if !Uninject(job) {
+		t.Fatal("Uninject() did not change the Job")
+	}
+	if !reflect.DeepEqual(&job.Spec.Template.Spec.Containers[1], untouched) {
+		t.Errorf("exporter container after Uninject() = %+v, want untouched %+v", job.Spec.Template.Spec.Containers[1], *untouched)
+	}
+}
+
+func TestInjectEphemeralContainers(t *testing.T) {
+	pgw := newInjectingPushgateway(nil)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "backup",
+			Namespace:   "default",
+			Annotations: map[string]string{constants.ContainersAnnotationName: "debug"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "main"}},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug"}},
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "shell"}},
+			},
+		},
+	}
+
+	updated, err := InjectEphemeralContainers(pod, pgw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("InjectEphemeralContainers() did not change the pod")
+	}
+	if !hasEnvVar(pod.Spec.EphemeralContainers[0].Env, constants.PushgatewayEnvVar) {
+		t.Error("debug ephemeral container not injected")
+	}
+	if len(pod.Spec.EphemeralContainers[1].Env) != 0 {
+		t.Errorf("shell ephemeral container env = %v, want untouched", pod.Spec.EphemeralContainers[1].Env)
+	}
+	if len(pod.Spec.Containers[0].Env) != 0 {
+		t.Errorf("main container env = %v, want untouched", pod.Spec.Containers[0].Env)
+	}
+}
+
+func hasEnvVar(envs []corev1.EnvVar, name string) bool {
+	for _, env := range envs {
+		if env.Name == name {
+			return true
+		}
+	}
+	return false
+}
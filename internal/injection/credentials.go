@@ -0,0 +1,59 @@
+package injection
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+)
+
+// EnsureClientSecret copies the credentials workloads push to the Pushgateway with
+// into the namespace, so injected workloads can reference them.
+// Client Secrets are then kept up to date by the Pushgateway controller.
+func EnsureClientSecret(c client.Client, pgw *monitoringv1alpha1.Pushgateway, namespace string, ctx context.Context) error {
+	if pgw.Spec.Web == nil {
+		return nil
+	}
+
+	webConfig := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: resources.WebConfigSecretName(pgw), Namespace: pgw.Namespace}, webConfig)
+	if k8serrors.IsNotFound(err) {
+		return fmt.Errorf("web configuration of Pushgateway %s/%s is not rendered yet", pgw.Namespace, pgw.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	desired := resources.PushgatewayClientSecret(pgw, webConfig, namespace)
+	found := &corev1.Secret{}
+	err = c.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: namespace}, found)
+	if k8serrors.IsNotFound(err) {
+		err = c.Create(ctx, desired)
+		if k8serrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Patched rather than updated, so the operator needs no update permission on Secrets
+	hash := constants.WebConfigHashAnnotationName
+	if found.Annotations[hash] != desired.Annotations[hash] {
+		patch := client.MergeFrom(found.DeepCopy())
+		util.MergeMetadata(&found.ObjectMeta, desired.ObjectMeta)
+		found.Data = desired.Data
+		return c.Patch(ctx, found, patch)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package injection
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+func TestInjectCredentials(t *testing.T) {
+	pgw := newSecuredPushgateway()
+	job := newInjectableJob()
+	job.Namespace = "jobs"
+
+	if _, err := Inject(job, pgw); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]corev1.EnvVar{}
+	for _, envVar := range job.Spec.Template.Spec.Containers[0].Env {
+		env[envVar.Name] = envVar
+	}
+
+	if got, want := env[constants.PushgatewayEnvVar].Value, "https://pushgateway-pushgateway.default.svc:9091/metrics/job/backup"; got != want {
+		t.Errorf("%s = %s, want %s", constants.PushgatewayEnvVar, got, want)
+	}
+	for name, key := range map[string]string{
+		constants.PushgatewayUsernameEnvVar: constants.WebUsernameKey,
+		constants.PushgatewayPasswordEnvVar: constants.WebPasswordKey,
+	} {
+		ref := env[name].ValueFrom
+		if ref == nil || ref.SecretKeyRef == nil || ref.SecretKeyRef.Name != resources.ClientSecretName(pgw) || ref.SecretKeyRef.Key != key {
+			t.Errorf("%s = %+v, want a reference to the %s key of the client Secret", name, env[name], key)
+		}
+	}
+	if got, want := env[constants.PushgatewayCAFileEnvVar].Value, constants.PushgatewayCAMountPath+"/"+constants.WebCAKey; got != want {
+		t.Errorf("%s = %s, want %s", constants.PushgatewayCAFileEnvVar, got, want)
+	}
+
+	mounted := false
+	for _, mount := range job.Spec.Template.Spec.Containers[0].VolumeMounts {
+		mounted = mounted || mount.Name == constants.PushgatewayCAVolumeName && mount.MountPath == constants.PushgatewayCAMountPath
+	}
+	if !mounted {
+		t.Error("CA volume is not mounted")
+	}
+}
+
+func TestEnsureClientSecret(t *testing.T) {
+	pgw := newSecuredPushgateway()
+	webConfig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        resources.WebConfigSecretName(pgw),
+			Namespace:   pgw.Namespace,
+			Annotations: map[string]string{constants.WebConfigHashAnnotationName: "v1"},
+		},
+		Data: map[string][]byte{
+			constants.WebUsernameKey:     []byte("scrape"),
+			constants.WebPasswordKey:     []byte("scrape-password"),
+			constants.WebPushUsernameKey: []byte(constants.WebPushUsername),
+			constants.WebPushPasswordKey: []byte("push-password"),
+			constants.WebCAKey:           []byte("ca"),
+		},
+	}
+	c := newFakeClient(t, webConfig)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: resources.ClientSecretName(pgw), Namespace: "jobs"}
+
+	if err := EnsureClientSecret(c, pgw, "jobs", ctx); err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	// Only the push user is copied
+	if string(secret.Data[constants.WebUsernameKey]) != constants.WebPushUsername || string(secret.Data[constants.WebPasswordKey]) != "push-password" {
+		t.Errorf("credentials = %q, want the push user", secret.Data)
+	}
+	if string(secret.Data[constants.WebCAKey]) != "ca" {
+		t.Errorf("CA = %q, want ca", secret.Data[constants.WebCAKey])
+	}
+
+	// Rotated credentials are copied again
+	webConfig.Annotations[constants.WebConfigHashAnnotationName] = "v2"
+	webConfig.Data[constants.WebPushPasswordKey] = []byte("rotated")
+	if err := c.Update(ctx, webConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureClientSecret(c, pgw, "jobs", ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[constants.WebPasswordKey]) != "rotated" {
+		t.Errorf("password = %q, want rotated", secret.Data[constants.WebPasswordKey])
+	}
+	if hash := secret.Annotations[constants.WebConfigHashAnnotationName]; hash != "v2" {
+		t.Errorf("hash = %s, want v2", hash)
+	}
+}
+
+func TestEnsureClientSecretNotRendered(t *testing.T) {
+	if err := EnsureClientSecret(newFakeClient(t), newSecuredPushgateway(), "jobs", context.Background()); err == nil {
+		t.Error("EnsureClientSecret() before the web configuration is rendered should fail")
+	}
+}
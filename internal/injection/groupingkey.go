@@ -0,0 +1,210 @@
+package injection
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+// podNameRef is rendered in place of .PodName. It is expanded by the kubelet
+// from the environment variable set through the downward API.
+var podNameRef = fmt.Sprintf("$(%s)", constants.PushgatewayPodNameEnvVar)
+
+// runRef is rendered in place of the run of CronJobs, which is only known
+// once their Job is spawned
+var runRef = fmt.Sprintf("$(%s)", constants.PushgatewayRunEnvVar)
+
+// groupingKeyData is what grouping key templates are rendered with
+type groupingKeyData struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+	PodName     string
+	CronJob     string
+	Run         string
+}
+
+// groupingKeyLabel is a rendered label of the grouping key
+type groupingKeyLabel struct {
+	name  string
+	value string
+}
+
+// GetGroupingKey returns the grouping key labels of the Pushgateway,
+// starting with the job label. Runs of CronJobs grouped separately are
+// labeled with their CronJob.
+func GetGroupingKey(pgw *monitoringv1alpha1.Pushgateway, cronJob bool) []monitoringv1alpha1.GroupingKeyLabel {
+	job := monitoringv1alpha1.GroupingKeyLabel{Name: "job", Value: constants.DefaultGroupingKeyJob}
+	labels := []monitoringv1alpha1.GroupingKeyLabel{}
+	hasCronJob := false
+
+	if pgw.Spec.Injection != nil {
+		for _, label := range pgw.Spec.Injection.GroupingKey {
+			if label.Name == "job" {
+				job = label
+				continue
+			}
+			hasCronJob = hasCronJob || label.Name == constants.CronJobGroupingKeyLabel
+			labels = append(labels, label)
+		}
+	}
+
+	if cronJob && !hasCronJob && resources.GetCronJobGroupingModeOrDefault(pgw) == monitoringv1alpha1.CronJobGroupingModeRun {
+		labels = append(labels, monitoringv1alpha1.GroupingKeyLabel{Name: constants.CronJobGroupingKeyLabel, Value: "{{.CronJob}}"})
+	}
+	return append([]monitoringv1alpha1.GroupingKeyLabel{job}, labels...)
+}
+
+// Builds the data grouping key templates are rendered with for a CronJob,
+// a Job spawned by a CronJob, or any other workload or pod
+func newGroupingKeyData(obj metav1.Object, pgw *monitoringv1alpha1.Pushgateway) *groupingKeyData {
+	data := &groupingKeyData{
+		Name:        obj.GetName(),
+		Namespace:   obj.GetNamespace(),
+		Labels:      obj.GetLabels(),
+		Annotations: obj.GetAnnotations(),
+		PodName:     podNameRef,
+		Run:         obj.GetName(),
+	}
+
+	// Pods are usually named by the API server after their admission
+	if _, ok := obj.(*corev1.Pod); ok && data.Name == "" {
+		data.Name = podNameRef
+		data.Run = podNameRef
+	}
+
+	if _, ok := obj.(*batchv1.CronJob); ok {
+		data.CronJob = obj.GetName()
+		data.Run = runRef
+	} else if owner := GetCronJobOwner(obj); owner != nil {
+		data.CronJob = owner.Name
+	} else {
+		return data
+	}
+
+	if resources.GetCronJobGroupingModeOrDefault(pgw) == monitoringv1alpha1.CronJobGroupingModeRun {
+		data.Name = data.Run
+	} else {
+		data.Name = data.CronJob
+	}
+	return data
+}
+
+// Renders the grouping key of the Pushgateway for the workload or pod
+func renderGroupingKey(obj metav1.Object, pgw *monitoringv1alpha1.Pushgateway) ([]groupingKeyLabel, error) {
+	data := newGroupingKeyData(obj, pgw)
+
+	key := []groupingKeyLabel{}
+	for _, label := range GetGroupingKey(pgw, data.CronJob != "") {
+		value, err := renderGroupingKeyValue(label, data)
+		if err != nil {
+			return nil, err
+		}
+		// Values holding a / are base64-encoded, which would hide the references from the kubelet
+		if strings.Contains(value, "/") && (strings.Contains(value, podNameRef) || strings.Contains(value, runRef)) {
+			return nil, fmt.Errorf("grouping key label %s holds a / along with the pod name or run, which cannot be pushed", label.Name)
+		}
+		key = append(key, groupingKeyLabel{name: label.Name, value: value})
+	}
+	return key, nil
+}
+
+// ValidateGroupingKey returns an error if a grouping key template of the Pushgateway cannot be parsed
+func ValidateGroupingKey(pgw *monitoringv1alpha1.Pushgateway) error {
+	for _, label := range GetGroupingKey(pgw, false) {
+		if _, err := template.New(label.Name).Parse(label.Value); err != nil {
+			return fmt.Errorf("parsing grouping key label %s: %w", label.Name, err)
+		}
+	}
+	return nil
+}
+
+func renderGroupingKeyValue(label monitoringv1alpha1.GroupingKeyLabel, data *groupingKeyData) (string, error) {
+	tmpl, err := template.New(label.Name).Option("missingkey=zero").Parse(label.Value)
+	if err != nil {
+		return "", fmt.Errorf("parsing grouping key label %s: %w", label.Name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("rendering grouping key label %s: %w", label.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// GetJobGroupingKeyValue returns the job label the Job pushes under.
+// It cannot be known when it depends on the pod name.
+func GetJobGroupingKeyValue(obj metav1.Object, pgw *monitoringv1alpha1.Pushgateway) (string, error) {
+	key, err := renderGroupingKey(obj, pgw)
+	if err != nil {
+		return "", err
+	}
+
+	job := key[0].value
+	if strings.Contains(job, podNameRef) {
+		return "", fmt.Errorf("job label of the grouping key depends on the pod name")
+	}
+	return job, nil
+}
+
+// Returns whether the grouping key refers to the pod name
+func usesPodName(key []groupingKeyLabel) bool {
+	for _, label := range key {
+		if strings.Contains(label.value, podNameRef) {
+			return true
+		}
+	}
+	return false
+}
+
+// Builds the push URL path of the grouping key, as the Pushgateway expects it.
+// Values are not escaped around the pod name and run references, so they can be expanded.
+func groupingKeyPath(key []groupingKeyLabel) string {
+	path := ""
+	for _, label := range key {
+		path += "/" + groupingKeyPathSegment(label)
+	}
+	return path
+}
+
+func groupingKeyPathSegment(label groupingKeyLabel) string {
+	// An empty value is represented by a single padding character
+	if label.value == "" {
+		return label.name + "@base64/="
+	}
+	if strings.Contains(label.value, "/") {
+		return label.name + "@base64/" + base64.URLEncoding.EncodeToString([]byte(label.value))
+	}
+
+	return label.name + "/" + escapeAround(label.value, podNameRef, runRef)
+}
+
+// Escapes the value for a URL path, except for the references
+func escapeAround(value string, refs ...string) string {
+	if len(refs) == 0 {
+		return url.PathEscape(value)
+	}
+
+	parts := strings.Split(value, refs[0])
+	for i, part := range parts {
+		parts[i] = escapeAround(part, refs[1:]...)
+	}
+	return strings.Join(parts, refs[0])
+}
+
+// Returns the name of the environment variable holding the grouping key label
+func groupingKeyEnvVarName(label groupingKeyLabel, pgw *monitoringv1alpha1.Pushgateway) string {
+	return resources.GetGroupingKeyEnvVarPrefixOrDefault(pgw) + strings.ToUpper(label.name)
+}
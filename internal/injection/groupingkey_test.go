@@ -0,0 +1,209 @@
+package injection
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+)
+
+func TestRenderGroupingKey(t *testing.T) {
+	controller := true
+	cronJobRun := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      "report-27000000",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", Controller: &controller},
+		},
+	}}
+
+	tests := []struct {
+		name      string
+		obj       metav1.Object
+		injection *monitoringv1alpha1.PushgatewayInjection
+		want      []groupingKeyLabel
+		wantErr   bool
+	}{
+		{
+			name: "default job label",
+			obj:  &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"}},
+			want: []groupingKeyLabel{{name: "job", value: "backup"}},
+		},
+		{
+			name: "job label first, other labels in order",
+			obj: &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+				Name:      "backup",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "db"},
+			}},
+			injection: &monitoringv1alpha1.PushgatewayInjection{GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{
+				{Name: "app", Value: "{{.Labels.app}}"},
+				{Name: "job", Value: "{{.Namespace}}-{{.Name}}"},
+				{Name: "team", Value: `{{index .Annotations "team"}}`},
+			}},
+			want: []groupingKeyLabel{
+				{name: "job", value: "default-backup"},
+				{name: "app", value: "db"},
+				{name: "team", value: ""},
+			},
+		},
+		{
+			name: "missing label renders empty",
+			obj:  &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"}},
+			injection: &monitoringv1alpha1.PushgatewayInjection{GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{
+				{Name: "app", Value: "{{.Labels.app}}"},
+			}},
+			want: []groupingKeyLabel{{name: "job", value: "backup"}, {name: "app", value: ""}},
+		},
+		{
+			name: "pod name resolved in the pod",
+			obj:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "worker-", Namespace: "default"}},
+			injection: &monitoringv1alpha1.PushgatewayInjection{GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{
+				{Name: "job", Value: "worker"},
+				{Name: "instance", Value: "{{.PodName}}"},
+			}},
+			want: []groupingKeyLabel{{name: "job", value: "worker"}, {name: "instance", value: podNameRef}},
+		},
+		{
+			name: "unnamed pod",
+			obj:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "worker-", Namespace: "default"}},
+			want: []groupingKeyLabel{{name: "job", value: podNameRef}},
+		},
+		{
+			name: "CronJob grouped under the CronJob",
+			obj:  &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default"}},
+			want: []groupingKeyLabel{{name: "job", value: "report"}},
+		},
+		{
+			name:      "CronJob grouped by run",
+			obj:       &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default"}},
+			injection: &monitoringv1alpha1.PushgatewayInjection{CronJobGroupingMode: monitoringv1alpha1.CronJobGroupingModeRun},
+			want:      []groupingKeyLabel{{name: "job", value: runRef}, {name: "cronjob", value: "report"}},
+		},
+		{
+			name:      "Job of a CronJob grouped by run",
+			obj:       cronJobRun,
+			injection: &monitoringv1alpha1.PushgatewayInjection{CronJobGroupingMode: monitoringv1alpha1.CronJobGroupingModeRun},
+			want:      []groupingKeyLabel{{name: "job", value: "report-27000000"}, {name: "cronjob", value: "report"}},
+		},
+		{
+			name: "Job of a CronJob grouped under the CronJob",
+			obj:  cronJobRun,
+			want: []groupingKeyLabel{{name: "job", value: "report"}},
+		},
+		{
+			name: "slash along with the pod name",
+			obj: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+				Name:      "worker",
+				Namespace: "default",
+				Labels:    map[string]string{"team": "data/eng"},
+			}},
+			injection: &monitoringv1alpha1.PushgatewayInjection{GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{
+				{Name: "instance", Value: "{{.Labels.team}}-{{.PodName}}"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "unknown field",
+			obj:  &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"}},
+			injection: &monitoringv1alpha1.PushgatewayInjection{GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{
+				{Name: "job", Value: "{{.Owner}}"},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := newInjectingPushgateway(tt.injection)
+			got, err := renderGroupingKey(tt.obj, pgw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderGroupingKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderGroupingKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateGroupingKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		groupingKey []monitoringv1alpha1.GroupingKeyLabel
+		wantErr     bool
+	}{
+		{name: "default"},
+		{name: "valid", groupingKey: []monitoringv1alpha1.GroupingKeyLabel{{Name: "job", Value: "{{.Namespace}}-{{.Name}}"}}},
+		{name: "unclosed action", groupingKey: []monitoringv1alpha1.GroupingKeyLabel{{Name: "job", Value: "{{.Name"}}, wantErr: true},
+		{name: "unknown function", groupingKey: []monitoringv1alpha1.GroupingKeyLabel{{Name: "app", Value: "{{lower .Name}}"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var injection *monitoringv1alpha1.PushgatewayInjection
+			if tt.groupingKey != nil {
+				injection = &monitoringv1alpha1.PushgatewayInjection{GroupingKey: tt.groupingKey}
+			}
+
+			err := ValidateGroupingKey(newInjectingPushgateway(injection))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateGroupingKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetJobGroupingKeyValue(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"}}
+
+	got, err := GetJobGroupingKeyValue(job, newInjectingPushgateway(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "backup" {
+		t.Errorf("GetJobGroupingKeyValue() = %s, want backup", got)
+	}
+
+	// The job label cannot be known outside of the pod
+	pgw := newInjectingPushgateway(&monitoringv1alpha1.PushgatewayInjection{GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{
+		{Name: "job", Value: "{{.Name}}-{{.PodName}}"},
+	}})
+	if _, err := GetJobGroupingKeyValue(job, pgw); err == nil {
+		t.Error("GetJobGroupingKeyValue() of a job label using the pod name should fail")
+	}
+}
+
+func TestGroupingKeyPath(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []groupingKeyLabel
+		want string
+	}{
+		{name: "plain", key: []groupingKeyLabel{{name: "job", value: "backup"}}, want: "/job/backup"},
+		{name: "empty value", key: []groupingKeyLabel{{name: "job", value: "backup"}, {name: "app", value: ""}}, want: "/job/backup/app@base64/="},
+		{name: "slash", key: []groupingKeyLabel{{name: "job", value: "a/b"}}, want: "/job@base64/YS9i"},
+		{name: "escaped", key: []groupingKeyLabel{{name: "job", value: "a b"}}, want: "/job/a%20b"},
+		{name: "references kept", key: []groupingKeyLabel{{name: "job", value: "run " + runRef}}, want: "/job/run%20" + runRef},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupingKeyPath(tt.key); got != tt.want {
+				t.Errorf("groupingKeyPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func newInjectingPushgateway(injection *monitoringv1alpha1.PushgatewayInjection) *monitoringv1alpha1.Pushgateway {
+	return &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec:       monitoringv1alpha1.PushgatewaySpec{Injection: injection},
+	}
+}
@@ -0,0 +1,379 @@
+package injection
+
+import (
+	"fmt"
+	"reflect"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+// injection is what is added to the pod spec of injected workloads
+type injection struct {
+	env     []corev1.EnvVar
+	volumes []corev1.Volume
+	mounts  []corev1.VolumeMount
+}
+
+// Inject adds the Pushgateway environment variables to the containers of the
+// workload or pod in place. Returns whether or not the object has been changed.
+func Inject(obj client.Object, pgw *monitoringv1alpha1.Pushgateway) (bool, error) {
+	spec := GetPodSpec(obj)
+	if spec == nil {
+		return false, fmt.Errorf("%T cannot be injected", obj)
+	}
+
+	inj, err := newInjection(obj, pgw)
+	if err != nil {
+		return false, err
+	}
+
+	// What was injected before is replaced, so nothing stale is left behind
+	original := spec.DeepCopy()
+	originalAnnotation := obj.GetAnnotations()[constants.InjectedAnnotationName]
+	uninjectPodSpec(spec, getInjectedConfig(obj))
+
+	injected := injectPodSpec(spec, inj, newContainerSelector(obj), hasVolumes(original.Volumes, inj.volumes))
+	injected.Pushgateway = fmt.Sprintf("%s/%s", pgw.Namespace, pgw.Name)
+	if err := setInjectedConfig(obj, injected); err != nil {
+		return false, err
+	}
+
+	updated := !reflect.DeepEqual(original, spec) || obj.GetAnnotations()[constants.InjectedAnnotationName] != originalAnnotation
+	return updated, nil
+}
+
+// InjectEphemeralContainers adds the Pushgateway environment variables to the selected
+// ephemeral containers of a pod injected when it was created, in place.
+// They are not recorded: the annotations of the pod cannot be updated along with
+// its ephemeral containers, which cannot be changed afterwards anyway.
+// Returns whether or not the pod has been changed.
+func InjectEphemeralContainers(pod *corev1.Pod, pgw *monitoringv1alpha1.Pushgateway) (bool, error) {
+	inj, err := newInjection(pod, pgw)
+	if err != nil {
+		return false, err
+	}
+	// Volumes cannot be added along with ephemeral containers
+	if !hasVolumes(pod.Spec.Volumes, inj.volumes) {
+		inj = &injection{env: inj.env}
+	}
+
+	original := pod.Spec.DeepCopy()
+	selector := newContainerSelector(pod)
+	for i := range pod.Spec.EphemeralContainers {
+		container := &pod.Spec.EphemeralContainers[i].EphemeralContainerCommon
+		if selector.selects(container.Name, containerKindEphemeral) {
+			injectContainer(&container.Env, &container.VolumeMounts, inj)
+		}
+	}
+
+	return !reflect.DeepEqual(original, &pod.Spec), nil
+}
+
+// IsStale returns whether the workload would be injected differently
+// with the current configuration of the Pushgateway
+func IsStale(obj client.Object, pgw *monitoringv1alpha1.Pushgateway) bool {
+	updated, err := Inject(obj.DeepCopyObject().(client.Object), pgw)
+	return err != nil || updated
+}
+
+// IsInjectionChanged returns whether the Pushgateway changed in a way
+// which changes what workloads are injected with or which workloads are injected
+func IsInjectionChanged(old *monitoringv1alpha1.Pushgateway, new *monitoringv1alpha1.Pushgateway) bool {
+	return !reflect.DeepEqual(injectionSettings(old), injectionSettings(new))
+}
+
+func injectionSettings(pgw *monitoringv1alpha1.Pushgateway) []interface{} {
+	return []interface{}{
+		resources.GetWebScheme(pgw),
+		resources.GetPortOrDefault(pgw),
+		resources.GetTelemetryPathOrDefault(pgw),
+		resources.IsWebBasicAuthEnabled(pgw),
+		resources.IsWebTLSEnabled(pgw) && pgw.Spec.Web.TLS.CA != nil,
+		pgw.Spec.Injection,
+		pgw.Spec.Sharding,
+		pgw.Spec.Default,
+		pgw.Spec.JobSelector,
+		pgw.Spec.JobNamespaceSelector,
+	}
+}
+
+// Injected returns an injected copy of the workload. Jobs are cleaned from
+// auto-generated fields so they can be re-created.
+func Injected(obj client.Object, pgw *monitoringv1alpha1.Pushgateway) (client.Object, bool, error) {
+	ret := obj.DeepCopyObject().(client.Object)
+
+	updated, err := Inject(ret, pgw)
+	if err != nil {
+		return nil, false, err
+	}
+	if job, ok := ret.(*batchv1.Job); ok && updated {
+		// Clean auto-generated fields
+		job.Spec.Selector = nil
+		delete(job.Spec.Template.Labels, "controller-uid")
+		job.ResourceVersion = ""
+	}
+	return ret, updated, nil
+}
+
+// Builds the injection of the Pushgateway URL and grouping key of the object and,
+// when its web endpoint is secured, of the credentials and CA certificate copied to the client Secret
+func newInjection(obj metav1.Object, pgw *monitoringv1alpha1.Pushgateway) (*injection, error) {
+	key, err := renderGroupingKey(obj, pgw)
+	if err != nil {
+		return nil, err
+	}
+
+	inj := &injection{}
+
+	// Variables must be defined before the ones referring to them
+	if _, ok := obj.(*batchv1.CronJob); ok {
+		inj.env = append(inj.env, corev1.EnvVar{
+			Name: constants.PushgatewayRunEnvVar,
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: fmt.Sprintf("metadata.labels['%s']", constants.JobNamePodLabelName)},
+			},
+		})
+	}
+	if usesPodName(key) {
+		inj.env = append(inj.env, corev1.EnvVar{
+			Name: constants.PushgatewayPodNameEnvVar,
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		})
+	}
+
+	mode := resources.GetGroupingKeyModeOrDefault(pgw)
+	address := getPushgatewayAddress(obj.GetNamespace(), getShard(obj, key, pgw), pgw)
+	if mode == monitoringv1alpha1.GroupingKeyModeEnvVars {
+		inj.env = append(inj.env, corev1.EnvVar{Name: resources.GetInjectionEnvVarNameOrDefault(pgw), Value: address})
+	} else {
+		inj.env = append(inj.env, corev1.EnvVar{
+			Name:  resources.GetInjectionEnvVarNameOrDefault(pgw),
+			Value: address + resources.GetTelemetryPathOrDefault(pgw) + groupingKeyPath(key),
+		})
+	}
+	if mode != monitoringv1alpha1.GroupingKeyModeURL {
+		for _, label := range key {
+			inj.env = append(inj.env, corev1.EnvVar{Name: groupingKeyEnvVarName(label, pgw), Value: label.value})
+		}
+	}
+
+	clientSecret := corev1.LocalObjectReference{Name: resources.ClientSecretName(pgw)}
+
+	if resources.IsWebBasicAuthEnabled(pgw) {
+		inj.env = append(inj.env,
+			secretKeyEnvVar(constants.PushgatewayUsernameEnvVar, clientSecret, constants.WebUsernameKey),
+			secretKeyEnvVar(constants.PushgatewayPasswordEnvVar, clientSecret, constants.WebPasswordKey),
+		)
+	}
+
+	if resources.IsWebTLSEnabled(pgw) && pgw.Spec.Web.TLS.CA != nil {
+		inj.env = append(inj.env, corev1.EnvVar{
+			Name:  constants.PushgatewayCAFileEnvVar,
+			Value: fmt.Sprintf("%s/%s", constants.PushgatewayCAMountPath, constants.WebCAKey),
+		})
+		inj.volumes = append(inj.volumes, corev1.Volume{
+			Name: constants.PushgatewayCAVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: clientSecret.Name,
+					Items: []corev1.KeyToPath{
+						{Key: constants.WebCAKey, Path: constants.WebCAKey},
+					},
+				},
+			},
+		})
+		inj.mounts = append(inj.mounts, corev1.VolumeMount{
+			Name:      constants.PushgatewayCAVolumeName,
+			MountPath: constants.PushgatewayCAMountPath,
+			ReadOnly:  true,
+		})
+	}
+
+	return inj, nil
+}
+
+func secretKeyEnvVar(name string, secret corev1.LocalObjectReference, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: secret,
+				Key:                  key,
+			},
+		},
+	}
+}
+
+// Adds the environment variables and volume mounts to the selected containers,
+// replacing those with the same name which differ. Containers that are
+// not selected are left untouched. Ephemeral containers only mount volumes
+// the pod already has, as volumes cannot be added along with them.
+// Returns what was injected.
+func injectPodSpec(spec *corev1.PodSpec, inj *injection, selector *containerSelector, ephemeralMounts bool) *injectedConfig {
+	injected := &injectedConfig{}
+	for _, env := range inj.env {
+		injected.Env = append(injected.Env, env)
+	}
+	for _, mount := range inj.mounts {
+		injected.Mounts = append(injected.Mounts, mount.Name)
+	}
+
+	for i := range spec.Containers {
+		if selector.selects(spec.Containers[i].Name, containerKindRegular) {
+			injectContainer(&spec.Containers[i].Env, &spec.Containers[i].VolumeMounts, inj)
+			injected.Containers = append(injected.Containers, spec.Containers[i].Name)
+		}
+	}
+	for i := range spec.InitContainers {
+		if selector.selects(spec.InitContainers[i].Name, containerKindInit) {
+			injectContainer(&spec.InitContainers[i].Env, &spec.InitContainers[i].VolumeMounts, inj)
+			injected.InitContainers = append(injected.InitContainers, spec.InitContainers[i].Name)
+		}
+	}
+	for i := range spec.EphemeralContainers {
+		container := &spec.EphemeralContainers[i].EphemeralContainerCommon
+		if !selector.selects(container.Name, containerKindEphemeral) {
+			continue
+		}
+		if ephemeralMounts {
+			injectContainer(&container.Env, &container.VolumeMounts, inj)
+		} else {
+			injectContainer(&container.Env, &container.VolumeMounts, &injection{env: inj.env})
+		}
+		injected.EphemeralContainers = append(injected.EphemeralContainers, container.Name)
+	}
+
+	// Volumes are only added for injected containers
+	if len(injected.Containers) > 0 || len(injected.InitContainers) > 0 {
+		for _, volume := range inj.volumes {
+			setVolume(&spec.Volumes, volume)
+			injected.Volumes = append(injected.Volumes, volume.Name)
+		}
+	}
+
+	return injected
+}
+
+func injectContainer(envs *[]corev1.EnvVar, mounts *[]corev1.VolumeMount, inj *injection) {
+	for _, env := range inj.env {
+		setEnvVar(envs, env)
+	}
+	for _, mount := range inj.mounts {
+		setVolumeMount(mounts, mount)
+	}
+}
+
+// Returns whether all the volumes are already in the pod spec
+func hasVolumes(volumes []corev1.Volume, wanted []corev1.Volume) bool {
+	for _, want := range wanted {
+		found := false
+		for _, volume := range volumes {
+			found = found || volume.Name == want.Name
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func setEnvVar(envs *[]corev1.EnvVar, patchEnv corev1.EnvVar) bool {
+	for i, env := range *envs {
+		if env.Name != patchEnv.Name {
+			continue
+		}
+		if reflect.DeepEqual(env, patchEnv) {
+			return false
+		}
+		(*envs)[i] = patchEnv
+		return true
+	}
+	*envs = append(*envs, patchEnv)
+	return true
+}
+
+func setVolume(volumes *[]corev1.Volume, patchVolume corev1.Volume) bool {
+	for i, volume := range *volumes {
+		if volume.Name != patchVolume.Name {
+			continue
+		}
+		if reflect.DeepEqual(volume, patchVolume) {
+			return false
+		}
+		(*volumes)[i] = patchVolume
+		return true
+	}
+	*volumes = append(*volumes, patchVolume)
+	return true
+}
+
+func setVolumeMount(mounts *[]corev1.VolumeMount, patchMount corev1.VolumeMount) bool {
+	for i, mount := range *mounts {
+		if mount.Name != patchMount.Name {
+			continue
+		}
+		if reflect.DeepEqual(mount, patchMount) {
+			return false
+		}
+		(*mounts)[i] = patchMount
+		return true
+	}
+	*mounts = append(*mounts, patchMount)
+	return true
+}
+
+func getPushgatewayAddress(namespace string, shard int32, pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s://%s:%d", resources.GetWebScheme(pgw), getPushgatewayHost(namespace, shard, pgw), resources.GetPortOrDefault(pgw))
+}
+
+// The short Service name only resolves from the Pushgateway namespace.
+// Certificates are verified against the fully qualified name, as Prometheus does.
+// Shards are reached through the DNS name of their pod rather than the Service.
+func getPushgatewayHost(namespace string, shard int32, pgw *monitoringv1alpha1.Pushgateway) string {
+	fqdn := namespace != pgw.Namespace || resources.IsWebTLSEnabled(pgw)
+	switch {
+	case resources.IsSharded(pgw) && fqdn:
+		return resources.ShardFQDN(pgw, shard)
+	case resources.IsSharded(pgw):
+		return fmt.Sprintf("%s.%s", resources.ShardName(pgw, shard), resources.ServiceName(pgw))
+	case fqdn:
+		return resources.ServiceFQDN(pgw)
+	}
+	return resources.ServiceName(pgw)
+}
+
+// IsInjectable returns whether the object is labeled for injection.
+// Objects spawned by an injectable workload are injected through its template.
+func IsInjectable(obj metav1.Object) bool {
+	if _, ok := obj.GetLabels()[constants.PushgatewayLabelName]; !ok || IsOptedOut(obj) {
+		return false
+	}
+	return !IsInjectedThroughOwner(obj)
+}
+
+// IsOptedOut returns whether the object is labeled not to be injected
+func IsOptedOut(obj metav1.Object) bool {
+	return obj.GetLabels()[constants.PushgatewayLabelName] == constants.PushgatewayLabelDisabledValue
+}
+
+// GetCronJobOwner returns the reference to the CronJob which spawned the Job, if any
+func GetCronJobOwner(obj metav1.Object) *metav1.OwnerReference {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil || owner.Kind != "CronJob" {
+		return nil
+	}
+	if gv, err := schema.ParseGroupVersion(owner.APIVersion); err != nil || gv.Group != batchv1.GroupName {
+		return nil
+	}
+	return owner
+}
@@ -0,0 +1,208 @@
+package injection
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+// GetPushgatewayName returns the name of the Pushgateway the object asks to be
+// injected with, through the Pushgateway annotation or the injection label value.
+// The annotation may name a Pushgateway in another namespace as namespace/name.
+// Returns an empty string when the default Pushgateway should be used.
+func GetPushgatewayName(obj metav1.Object) string {
+	if name := obj.GetAnnotations()[constants.PushgatewayAnnotationName]; name != "" {
+		return name
+	}
+
+	name := obj.GetLabels()[constants.PushgatewayLabelName]
+	for _, value := range constants.PushgatewayLabelDefaultValues() {
+		if name == value {
+			return ""
+		}
+	}
+	return name
+}
+
+// GetPushgatewayToInject returns the Pushgateway the object should be injected with,
+// or nil if it should not be injected. Objects labeled for injection are injected with
+// the Pushgateway they name or the default one. Unless they opt out, Jobs and CronJobs
+// of namespaces labeled for injection are injected with the default Pushgateway, and
+// those of other namespaces when the default Pushgateway policy is OptOut.
+func GetPushgatewayToInject(c client.Reader, obj client.Object, ctx context.Context) (*monitoringv1alpha1.Pushgateway, error) {
+	if IsInjectedThroughOwner(obj) || IsOptedOut(obj) {
+		return nil, nil
+	}
+	if IsInjectable(obj) {
+		return GetPushgatewayForObject(c, obj, ctx)
+	}
+	if !IsInjectableByDefault(obj) {
+		return nil, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, ns); err != nil {
+		return nil, err
+	}
+	if IsNamespaceInjected(ns) {
+		return getDefaultPushgateway(c, obj, ns, ctx)
+	}
+
+	// Namespaces without a Pushgateway are not an error when injection is not asked for
+	pgw, err := getDefaultPushgateway(c, obj, ns, ctx)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("No default Pushgateway", "namespace", obj.GetNamespace(), "name", obj.GetName(), "reason", err.Error())
+		return nil, nil
+	}
+	if resources.GetInjectionPolicyOrDefault(pgw) != monitoringv1alpha1.InjectionPolicyOptOut {
+		return nil, nil
+	}
+	return pgw, nil
+}
+
+// IsInjectableByDefault returns whether the object is a Job or CronJob, which are injected
+// without being labeled in namespaces labeled for injection or by OptOut Pushgateways
+func IsInjectableByDefault(obj client.Object) bool {
+	switch obj.(type) {
+	case *batchv1.Job, *batchv1.CronJob:
+		return true
+	}
+	return false
+}
+
+// IsNamespaceInjected returns whether the namespace is labeled to have its Jobs and CronJobs injected
+func IsNamespaceInjected(ns *corev1.Namespace) bool {
+	return ns.Labels[constants.NamespaceInjectionLabelName] == constants.NamespaceInjectionEnabledValue
+}
+
+// GetPushgatewayForObject returns the Pushgateway the object should be injected with.
+// A named Pushgateway must exist and select the object. Otherwise, the Pushgateway
+// selecting the object is looked for in the object namespace, then across namespaces.
+func GetPushgatewayForObject(c client.Reader, obj metav1.Object, ctx context.Context) (*monitoringv1alpha1.Pushgateway, error) {
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, ns); err != nil {
+		return nil, err
+	}
+
+	name := GetPushgatewayName(obj)
+	if name == "" {
+		return getDefaultPushgateway(c, obj, ns, ctx)
+	}
+
+	namespace := obj.GetNamespace()
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+
+	pgw := &monitoringv1alpha1.Pushgateway{}
+	err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, pgw)
+	if k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("Pushgateway %s not found in namespace %s", name, namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !SelectsObject(pgw, obj, ns) {
+		return nil, fmt.Errorf("Pushgateway %s/%s does not select %s/%s", pgw.Namespace, pgw.Name, obj.GetNamespace(), obj.GetName())
+	}
+
+	return pgw, nil
+}
+
+// SelectsObject returns whether or not the Pushgateway injects the object,
+// according to its namespace and labels
+func SelectsObject(pgw *monitoringv1alpha1.Pushgateway, obj metav1.Object, ns *corev1.Namespace) bool {
+	if pgw.Namespace != ns.Name {
+		if pgw.Spec.JobNamespaceSelector == nil {
+			return false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pgw.Spec.JobNamespaceSelector)
+		if err != nil || !selector.Matches(labels.Set(ns.Labels)) {
+			return false
+		}
+	}
+
+	if pgw.Spec.JobSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(pgw.Spec.JobSelector)
+		if err != nil || !selector.Matches(labels.Set(obj.GetLabels())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Looks for the Pushgateways selecting the object, preferring
+// those in the object namespace
+func getDefaultPushgateway(c client.Reader, obj metav1.Object, ns *corev1.Namespace, ctx context.Context) (*monitoringv1alpha1.Pushgateway, error) {
+	logger := log.FromContext(ctx)
+	pgwList := &monitoringv1alpha1.PushgatewayList{}
+	if err := c.List(ctx, pgwList); err != nil {
+		logger.Error(err, "Failed to list Pushgateways")
+		return nil, err
+	}
+
+	local := []monitoringv1alpha1.Pushgateway{}
+	remote := []monitoringv1alpha1.Pushgateway{}
+	for _, pgw := range pgwList.Items {
+		if !SelectsObject(&pgw, obj, ns) {
+			continue
+		}
+		if pgw.Namespace == ns.Name {
+			local = append(local, pgw)
+		} else {
+			remote = append(remote, pgw)
+		}
+	}
+
+	if len(local) > 0 {
+		return choosePushgateway(local, "in namespace "+ns.Name)
+	}
+
+	if len(remote) > 0 {
+		return choosePushgateway(remote, "selecting namespace "+ns.Name)
+	}
+
+	return nil, fmt.Errorf("no Pushgateways found in namespace %s or selecting it", ns.Name)
+}
+
+// Returns the only Pushgateway, or the single one marked as default
+func choosePushgateway(pgws []monitoringv1alpha1.Pushgateway, where string) (*monitoringv1alpha1.Pushgateway, error) {
+	if len(pgws) == 1 {
+		return &pgws[0], nil
+	}
+
+	var defaultPgw *monitoringv1alpha1.Pushgateway
+	for i := range pgws {
+		if !pgws[i].Spec.Default {
+			continue
+		}
+		if defaultPgw != nil {
+			err := fmt.Errorf("more than 1 default Pushgateway found %s", where)
+			return nil, err
+		}
+		defaultPgw = &pgws[i]
+	}
+
+	if defaultPgw == nil {
+		err := fmt.Errorf("more than 1 Pushgateway found %s and none is marked as default, "+
+			"name one through the %s label value or the %s annotation", where, constants.PushgatewayLabelName, constants.PushgatewayAnnotationName)
+		return nil, err
+	}
+
+	return defaultPgw, nil
+}
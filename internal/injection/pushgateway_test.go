@@ -0,0 +1,284 @@
+package injection
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestGetPushgatewayName(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		want        string
+	}{
+		{name: "bare label", labels: map[string]string{constants.PushgatewayLabelName: ""}},
+		{name: "true label", labels: map[string]string{constants.PushgatewayLabelName: "true"}},
+		{name: "named by label", labels: map[string]string{constants.PushgatewayLabelName: "etl"}, want: "etl"},
+		{
+			name:        "named by annotation",
+			labels:      map[string]string{constants.PushgatewayLabelName: "etl"},
+			annotations: map[string]string{constants.PushgatewayAnnotationName: "monitoring/ci"},
+			want:        "monitoring/ci",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &metav1.ObjectMeta{Labels: tt.labels, Annotations: tt.annotations}
+			if got := GetPushgatewayName(obj); got != tt.want {
+				t.Errorf("GetPushgatewayName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPushgatewayForObject(t *testing.T) {
+	etl := newNamedPushgateway("etl", "jobs")
+	ci := newNamedPushgateway("ci", "jobs")
+	ci.Spec.Default = true
+	c := newFakeClient(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "jobs"}}, etl, ci)
+
+	tests := []struct {
+		name    string
+		label   string
+		want    string
+		wantErr bool
+	}{
+		{name: "named", label: "etl", want: "etl"},
+		{name: "default", label: "true", want: "ci"},
+		{name: "missing", label: "missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newInjectableJob()
+			job.Namespace = "jobs"
+			job.Labels = map[string]string{constants.PushgatewayLabelName: tt.label}
+
+			got, err := GetPushgatewayForObject(c, job, context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPushgatewayForObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != nil && got.Name != tt.want {
+				t.Errorf("GetPushgatewayForObject() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPushgatewayToInject(t *testing.T) {
+	labeled := map[string]string{constants.NamespaceInjectionLabelName: constants.NamespaceInjectionEnabledValue}
+
+	tests := []struct {
+		name            string
+		namespaceLabels map[string]string
+		policy          monitoringv1alpha1.InjectionPolicy
+		noPushgateway   bool
+		obj             client.Object
+		wantInjected    bool
+		wantErr         bool
+	}{
+		{name: "labeled namespace", namespaceLabels: labeled, obj: newInjectableJob(), wantInjected: true},
+		{name: "labeled namespace CronJob", namespaceLabels: labeled, obj: &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default"}}, wantInjected: true},
+		{name: "labeled namespace opted out", namespaceLabels: labeled, obj: func() client.Object {
+			job := newInjectableJob()
+			job.Labels = map[string]string{constants.PushgatewayLabelName: constants.PushgatewayLabelDisabledValue}
+			return job
+		}(), wantInjected: false},
+		{name: "labeled namespace Deployment", namespaceLabels: labeled, obj: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default"}}, wantInjected: false},
+		{name: "labeled namespace without Pushgateway", namespaceLabels: labeled, noPushgateway: true, obj: newInjectableJob(), wantErr: true},
+		{name: "OptIn", obj: newInjectableJob(), wantInjected: false},
+		{name: "OptOut", policy: monitoringv1alpha1.InjectionPolicyOptOut, obj: newInjectableJob(), wantInjected: true},
+		{name: "without Pushgateway", noPushgateway: true, obj: newInjectableJob(), wantInjected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: tt.namespaceLabels}}}
+			if !tt.noPushgateway {
+				pgw := newNamedPushgateway("pushgateway", "default")
+				if tt.policy != "" {
+					pgw.Spec.Injection = &monitoringv1alpha1.PushgatewayInjection{Policy: tt.policy}
+				}
+				objs = append(objs, pgw)
+			}
+
+			got, err := GetPushgatewayToInject(newFakeClient(t, objs...), tt.obj, context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPushgatewayToInject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if injected := got != nil; injected != tt.wantInjected {
+				t.Errorf("injected = %t, want %t", injected, tt.wantInjected)
+			}
+		})
+	}
+}
+
+func TestChoosePushgateway(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults []bool
+		want     string
+		wantErr  bool
+	}{
+		{name: "single", defaults: []bool{false}, want: "pgw-0"},
+		{name: "single default", defaults: []bool{false, true}, want: "pgw-1"},
+		{name: "no default", defaults: []bool{false, false}, wantErr: true},
+		{name: "several defaults", defaults: []bool{true, true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgws := []monitoringv1alpha1.Pushgateway{}
+			for i, isDefault := range tt.defaults {
+				pgw := newNamedPushgateway(fmt.Sprintf("pgw-%d", i), "jobs")
+				pgw.Spec.Default = isDefault
+				pgws = append(pgws, *pgw)
+			}
+
+			got, err := choosePushgateway(pgws, "in namespace jobs")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("choosePushgateway() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != nil && got.Name != tt.want {
+				t.Errorf("choosePushgateway() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectsObject(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant", Labels: map[string]string{"tenant": "true"}}}
+
+	tests := []struct {
+		name              string
+		namespace         string
+		namespaceSelector *metav1.LabelSelector
+		jobSelector       *metav1.LabelSelector
+		want              bool
+	}{
+		{name: "same namespace", namespace: "tenant", want: true},
+		{name: "other namespace without selector", namespace: "monitoring", want: false},
+		{
+			name:              "other namespace selected",
+			namespace:         "monitoring",
+			namespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			want:              true,
+		},
+		{
+			name:              "other namespace not selected",
+			namespace:         "monitoring",
+			namespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "false"}},
+			want:              false,
+		},
+		{
+			name:        "job selected",
+			namespace:   "tenant",
+			jobSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "etl"}},
+			want:        true,
+		},
+		{
+			name:        "job not selected",
+			namespace:   "tenant",
+			jobSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "ci"}},
+			want:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := newNamedPushgateway("pushgateway", tt.namespace)
+			pgw.Spec.JobNamespaceSelector = tt.namespaceSelector
+			pgw.Spec.JobSelector = tt.jobSelector
+			job := &metav1.ObjectMeta{Name: "backup", Namespace: "tenant", Labels: map[string]string{"team": "etl"}}
+
+			if got := SelectsObject(pgw, job, ns); got != tt.want {
+				t.Errorf("SelectsObject() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPushgatewayForObjectAcrossNamespaces(t *testing.T) {
+	shared := newNamedPushgateway("shared", "monitoring")
+	shared.Spec.JobNamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}}
+	c := newFakeClient(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant", Labels: map[string]string{"tenant": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		shared,
+	)
+
+	tests := []struct {
+		name      string
+		namespace string
+		label     string
+		want      string
+		wantErr   bool
+	}{
+		{name: "default across namespaces", namespace: "tenant", label: "true", want: "shared"},
+		{name: "named across namespaces", namespace: "tenant", label: "", want: "shared"},
+		{name: "namespace not selected", namespace: "other", label: "true", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newInjectableJob()
+			job.Namespace = tt.namespace
+			job.Labels = map[string]string{constants.PushgatewayLabelName: tt.label}
+			if tt.label == "" {
+				job.Annotations = map[string]string{constants.PushgatewayAnnotationName: "monitoring/shared"}
+			}
+
+			got, err := GetPushgatewayForObject(c, job, context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetPushgatewayForObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != nil && got.Name != tt.want {
+				t.Errorf("GetPushgatewayForObject() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPushgatewayAddress(t *testing.T) {
+	pgw := newNamedPushgateway("shared", "monitoring")
+
+	if got, want := getPushgatewayAddress("monitoring", 0, pgw), "http://shared-pushgateway:9091"; got != want {
+		t.Errorf("same namespace address = %s, want %s", got, want)
+	}
+	if got, want := getPushgatewayAddress("tenant", 0, pgw), "http://shared-pushgateway.monitoring.svc:9091"; got != want {
+		t.Errorf("other namespace address = %s, want %s", got, want)
+	}
+}
+
+func newNamedPushgateway(name string, namespace string) *monitoringv1alpha1.Pushgateway {
+	return &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+// Returns a fake client knowing about Pushgateways
+func newFakeClient(t *testing.T, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		monitoringv1alpha1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
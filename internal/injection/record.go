@@ -0,0 +1,163 @@
+package injection
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+// injectedConfig records what was injected into a workload or pod, in its
+// injected annotation, so the injection can be replaced or reversed
+type injectedConfig struct {
+	// Pushgateway the object was injected with, as namespace/name
+	Pushgateway         string          `json:"pushgateway"`
+	Env                 []corev1.EnvVar `json:"env,omitempty"`
+	Volumes             []string        `json:"volumes,omitempty"`
+	Mounts              []string        `json:"mounts,omitempty"`
+	Containers          []string        `json:"containers,omitempty"`
+	InitContainers      []string        `json:"initContainers,omitempty"`
+	EphemeralContainers []string        `json:"ephemeralContainers,omitempty"`
+}
+
+// IsInjected returns whether the object records an injection
+func IsInjected(obj client.Object) bool {
+	_, ok := obj.GetAnnotations()[constants.InjectedAnnotationName]
+	return ok
+}
+
+// GetInjectedPushgateway returns the Pushgateway the object was injected with,
+// as namespace/name, or an empty string if it was not injected
+func GetInjectedPushgateway(obj client.Object) string {
+	injected := getInjectedConfig(obj)
+	if injected == nil {
+		return ""
+	}
+	return injected.Pushgateway
+}
+
+// Uninject removes what was injected into the workload or pod in place,
+// along with the injected annotation. Returns whether the object has been changed.
+func Uninject(obj client.Object) bool {
+	spec := GetPodSpec(obj)
+	injected := getInjectedConfig(obj)
+	if spec == nil || !IsInjected(obj) {
+		return false
+	}
+
+	uninjectPodSpec(spec, injected)
+	annotations := obj.GetAnnotations()
+	delete(annotations, constants.InjectedAnnotationName)
+	obj.SetAnnotations(annotations)
+	return true
+}
+
+// Returns the recorded injection, or nil if there is none or it cannot be read
+func getInjectedConfig(obj client.Object) *injectedConfig {
+	value, ok := obj.GetAnnotations()[constants.InjectedAnnotationName]
+	if !ok {
+		return nil
+	}
+
+	injected := &injectedConfig{}
+	if err := json.Unmarshal([]byte(value), injected); err != nil {
+		return nil
+	}
+	return injected
+}
+
+func setInjectedConfig(obj client.Object, injected *injectedConfig) error {
+	value, err := json.Marshal(injected)
+	if err != nil {
+		return fmt.Errorf("recording injection: %w", err)
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[constants.InjectedAnnotationName] = string(value)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// Removes the recorded environment variables, volume mounts and volumes
+// from the containers they were injected into
+func uninjectPodSpec(spec *corev1.PodSpec, injected *injectedConfig) {
+	if injected == nil {
+		return
+	}
+
+	envs := map[string]bool{}
+	for _, env := range injected.Env {
+		envs[env.Name] = true
+	}
+	mounts := toSet(injected.Mounts)
+
+	containers := toSet(injected.Containers)
+	for i := range spec.Containers {
+		if containers[spec.Containers[i].Name] {
+			uninjectContainer(&spec.Containers[i].Env, &spec.Containers[i].VolumeMounts, envs, mounts)
+		}
+	}
+	initContainers := toSet(injected.InitContainers)
+	for i := range spec.InitContainers {
+		if initContainers[spec.InitContainers[i].Name] {
+			uninjectContainer(&spec.InitContainers[i].Env, &spec.InitContainers[i].VolumeMounts, envs, mounts)
+		}
+	}
+	ephemeralContainers := toSet(injected.EphemeralContainers)
+	for i := range spec.EphemeralContainers {
+		container := &spec.EphemeralContainers[i].EphemeralContainerCommon
+		if ephemeralContainers[container.Name] {
+			uninjectContainer(&container.Env, &container.VolumeMounts, envs, mounts)
+		}
+	}
+
+	volumes := toSet(injected.Volumes)
+	kept := spec.Volumes[:0]
+	for _, volume := range spec.Volumes {
+		if !volumes[volume.Name] {
+			kept = append(kept, volume)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	spec.Volumes = kept
+}
+
+func uninjectContainer(envs *[]corev1.EnvVar, mounts *[]corev1.VolumeMount, envNames map[string]bool, mountNames map[string]bool) {
+	keptEnvs := (*envs)[:0]
+	for _, env := range *envs {
+		if !envNames[env.Name] {
+			keptEnvs = append(keptEnvs, env)
+		}
+	}
+	if len(keptEnvs) == 0 {
+		keptEnvs = nil
+	}
+	*envs = keptEnvs
+
+	keptMounts := (*mounts)[:0]
+	for _, mount := range *mounts {
+		if !mountNames[mount.Name] {
+			keptMounts = append(keptMounts, mount)
+		}
+	}
+	if len(keptMounts) == 0 {
+		keptMounts = nil
+	}
+	*mounts = keptMounts
+}
+
+func toSet(names []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
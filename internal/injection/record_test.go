@@ -0,0 +1,129 @@
+package injection
+
+import (
+	"reflect"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestInjectRoundTrip(t *testing.T) {
+	pgw := newSecuredPushgateway()
+	job := newInjectableJob()
+	original := job.Spec.Template.Spec.DeepCopy()
+
+	updated, err := Inject(job, pgw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("Inject() did not change the Job")
+	}
+	if got := GetInjectedPushgateway(job); got != "default/pushgateway" {
+		t.Errorf("GetInjectedPushgateway() = %s, want default/pushgateway", got)
+	}
+	if !hasVolumes(job.Spec.Template.Spec.Volumes, []corev1.Volume{{Name: constants.PushgatewayCAVolumeName}}) {
+		t.Error("Inject() did not add the CA volume")
+	}
+
+	if IsStale(job, pgw) {
+		t.Error("IsStale() right after Inject() = true")
+	}
+	if updated, _ := Inject(job, pgw); updated {
+		t.Error("Inject() twice changed the Job")
+	}
+
+	if !Uninject(job) {
+		t.Fatal("Uninject() did not change the Job")
+	}
+	if IsInjected(job) {
+		t.Error("Uninject() kept the injected annotation")
+	}
+	if !reflect.DeepEqual(&job.Spec.Template.Spec, original) {
+		t.Errorf("Uninject() = %+v, want %+v", job.Spec.Template.Spec, *original)
+	}
+	if Uninject(job) {
+		t.Error("Uninject() of a Job which is not injected changed it")
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(pgw *monitoringv1alpha1.Pushgateway)
+	}{
+		{name: "port", change: func(pgw *monitoringv1alpha1.Pushgateway) { pgw.Spec.Port = 9092 }},
+		{name: "telemetry path", change: func(pgw *monitoringv1alpha1.Pushgateway) { pgw.Spec.TelemetryPath = "/push" }},
+		{name: "env var name", change: func(pgw *monitoringv1alpha1.Pushgateway) {
+			pgw.Spec.Injection = &monitoringv1alpha1.PushgatewayInjection{EnvVarName: "PUSH_URL"}
+		}},
+		{name: "basic auth disabled", change: func(pgw *monitoringv1alpha1.Pushgateway) { pgw.Spec.Web.BasicAuthUsers = nil }},
+		{name: "TLS disabled", change: func(pgw *monitoringv1alpha1.Pushgateway) { pgw.Spec.Web.TLS = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := newSecuredPushgateway()
+			job := newInjectableJob()
+			if _, err := Inject(job, pgw); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.change(pgw)
+			if !IsStale(job, pgw) {
+				t.Fatal("IsStale() = false, want true")
+			}
+
+			// Re-injecting replaces what was injected before
+			reinjected := newInjectableJob()
+			if _, err := Inject(reinjected, pgw); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Inject(job, pgw); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(job.Spec.Template.Spec, reinjected.Spec.Template.Spec) {
+				t.Errorf("re-injected spec = %+v, want %+v", job.Spec.Template.Spec, reinjected.Spec.Template.Spec)
+			}
+		})
+	}
+}
+
+func newSecuredPushgateway() *monitoringv1alpha1.Pushgateway {
+	pgw := newInjectingPushgateway(nil)
+	pgw.Spec.Web = &monitoringv1alpha1.PushgatewayWeb{
+		TLS: &monitoringv1alpha1.PushgatewayWebTLS{
+			CA: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "pushgateway-tls"},
+				Key:                  "ca.crt",
+			},
+		},
+		BasicAuthUsers: &corev1.LocalObjectReference{Name: "pushgateway-users"},
+	}
+	return pgw
+}
+
+// Returns a Job with environment variables and volumes of its own
+func newInjectableJob() *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:         "backup",
+						Env:          []corev1.EnvVar{{Name: "TARGET", Value: "db"}},
+						VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+					}},
+					InitContainers: []corev1.Container{{Name: "init"}},
+					Volumes:        []corev1.Volume{{Name: "data"}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,42 @@
+package injection
+
+import (
+	"hash/fnv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+// Returns the shard of the Pushgateway the workload pushes to.
+// Workloads are hashed on the job label of their grouping key, so every group
+// of a job is held by the same shard. CronJobs are hashed on their name,
+// as their runs are only known once spawned. Job labels referring to the pod
+// name are only known in the pod, so the workload is hashed on its identity:
+// its pods push distinct jobs anyway.
+func getShard(obj metav1.Object, key []groupingKeyLabel, pgw *monitoringv1alpha1.Pushgateway) int32 {
+	shardKey := key[0].value
+	if cronJob := newGroupingKeyData(obj, pgw).CronJob; cronJob != "" {
+		shardKey = cronJob
+	} else if strings.Contains(shardKey, podNameRef) {
+		shardKey = obj.GetNamespace() + "/" + obj.GetName()
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(shardKey))
+	return jumpHash(h.Sum64(), resources.GetShardsOrDefault(pgw))
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach. Only the keys
+// of one shard in n move when shards are added or removed.
+func jumpHash(key uint64, shards int32) int32 {
+	b, j := int64(-1), int64(0)
+	for j < int64(shards) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
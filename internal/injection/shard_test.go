@@ -0,0 +1,138 @@
+package injection
+
+import (
+	"hash/fnv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+)
+
+// Shard routing must not change across operator versions: workloads injected
+// by an older version would push to another shard than their groups are on.
+
+func TestJumpHash(t *testing.T) {
+	// Reference values of the jump consistent hash
+	tests := []struct {
+		key    uint64
+		shards int32
+		want   int32
+	}{
+		{key: 1, shards: 1, want: 0},
+		{key: 42, shards: 57, want: 43},
+		{key: 0xDEAD10CC, shards: 1, want: 0},
+		{key: 0xDEAD10CC, shards: 666, want: 361},
+		{key: 256, shards: 1024, want: 520},
+	}
+
+	for _, tt := range tests {
+		if got := jumpHash(tt.key, tt.shards); got != tt.want {
+			t.Errorf("jumpHash(%d, %d) = %d, want %d", tt.key, tt.shards, got, tt.want)
+		}
+	}
+}
+
+func TestGetShard(t *testing.T) {
+	tests := []struct {
+		job    string
+		shards int32
+		want   int32
+	}{
+		{job: "backup", shards: 1, want: 0},
+		{job: "backup", shards: 3, want: 0},
+		{job: "backup", shards: 10, want: 0},
+		{job: "report", shards: 3, want: 1},
+		{job: "report", shards: 4, want: 1},
+		{job: "report", shards: 10, want: 8},
+		{job: "db-migrate", shards: 3, want: 1},
+		{job: "db-migrate", shards: 10, want: 9},
+		{job: "cleanup", shards: 4, want: 1},
+		{job: "cleanup", shards: 10, want: 7},
+		{job: "nightly-etl", shards: 3, want: 0},
+		{job: "nightly-etl", shards: 4, want: 3},
+		{job: "billing", shards: 3, want: 2},
+		{job: "billing", shards: 10, want: 2},
+	}
+
+	for _, tt := range tests {
+		pgw := newShardedPushgateway(tt.shards)
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: tt.job, Namespace: "default"}}
+		key, err := renderGroupingKey(job, pgw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := getShard(job, key, pgw); got != tt.want {
+			t.Errorf("getShard(%s) with %d shards = %d, want %d", tt.job, tt.shards, got, tt.want)
+		}
+	}
+}
+
+func TestGetShardCronJob(t *testing.T) {
+	// Runs are grouped separately, but are all held by the shard of their CronJob
+	pgw := newShardedPushgateway(4)
+	pgw.Spec.Injection = &monitoringv1alpha1.PushgatewayInjection{CronJobGroupingMode: monitoringv1alpha1.CronJobGroupingModeRun}
+
+	controller := true
+	objs := []metav1.Object{
+		&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default"}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:      "report-27000000",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", Controller: &controller},
+			},
+		}},
+	}
+
+	for _, obj := range objs {
+		key, err := renderGroupingKey(obj, pgw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := getShard(obj, key, pgw); got != 1 {
+			t.Errorf("getShard(%T %s) = %d, want 1", obj, obj.GetName(), got)
+		}
+	}
+}
+
+func TestGetShardPodName(t *testing.T) {
+	pgw := newShardedPushgateway(10)
+	pgw.Spec.Injection = &monitoringv1alpha1.PushgatewayInjection{GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{
+		{Name: "job", Value: "{{.PodName}}"},
+	}}
+
+	// Job labels referring to the pod name all render the same before expansion
+	shards := map[int32]bool{}
+	for _, name := range []string{"api", "worker", "scheduler", "indexer", "mailer"} {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		key, err := renderGroupingKey(deployment, pgw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte("default/" + name))
+		want := jumpHash(h.Sum64(), 10)
+		got := getShard(deployment, key, pgw)
+		if got != want {
+			t.Errorf("getShard(%s) = %d, want %d", name, got, want)
+		}
+		shards[got] = true
+	}
+	if len(shards) < 2 {
+		t.Errorf("workloads are all routed to shards %v", shards)
+	}
+}
+
+func newShardedPushgateway(shards int32) *monitoringv1alpha1.Pushgateway {
+	return &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec: monitoringv1alpha1.PushgatewaySpec{
+			Sharding: &monitoringv1alpha1.PushgatewaySharding{Shards: shards},
+		},
+	}
+}
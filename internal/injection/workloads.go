@@ -0,0 +1,89 @@
+package injection
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewObject returns an empty object of the injectable kind,
+// or nil if objects of the kind cannot be injected
+func NewObject(kind schema.GroupKind) client.Object {
+	switch kind {
+	case corev1.SchemeGroupVersion.WithKind("Pod").GroupKind():
+		return &corev1.Pod{}
+	case appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind():
+		return &appsv1.Deployment{}
+	case appsv1.SchemeGroupVersion.WithKind("StatefulSet").GroupKind():
+		return &appsv1.StatefulSet{}
+	case appsv1.SchemeGroupVersion.WithKind("DaemonSet").GroupKind():
+		return &appsv1.DaemonSet{}
+	case batchv1.SchemeGroupVersion.WithKind("Job").GroupKind():
+		return &batchv1.Job{}
+	case batchv1.SchemeGroupVersion.WithKind("CronJob").GroupKind():
+		return &batchv1.CronJob{}
+	}
+	return nil
+}
+
+// GetPodSpec returns the spec of the pod or of the pod template of the workload,
+// or nil if the object cannot be injected
+func GetPodSpec(obj client.Object) *corev1.PodSpec {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return &o.Spec
+	case *appsv1.Deployment:
+		return &o.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template.Spec
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template.Spec
+	case *batchv1.Job:
+		return &o.Spec.Template.Spec
+	case *batchv1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.Spec
+	}
+	return nil
+}
+
+// IsPodSpecImmutable returns whether the pod spec of the object cannot be updated,
+// so it can only be injected when created
+func IsPodSpecImmutable(obj client.Object) bool {
+	switch obj.(type) {
+	case *corev1.Pod, *batchv1.Job:
+		return true
+	}
+	return false
+}
+
+// IsInjectedThroughOwner returns whether the object is spawned by a workload
+// which is injected through its template: Jobs of CronJobs, and pods of
+// ReplicaSets, StatefulSets, DaemonSets and Jobs. ReplicaSets are in turn
+// spawned by Deployments.
+func IsInjectedThroughOwner(obj metav1.Object) bool {
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil {
+		return false
+	}
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	if err != nil {
+		return false
+	}
+
+	switch obj.(type) {
+	case *batchv1.Job:
+		return gv.Group == batchv1.GroupName && owner.Kind == "CronJob"
+	case *corev1.Pod:
+		switch gv.WithKind(owner.Kind).GroupKind() {
+		case appsv1.SchemeGroupVersion.WithKind("ReplicaSet").GroupKind(),
+			appsv1.SchemeGroupVersion.WithKind("StatefulSet").GroupKind(),
+			appsv1.SchemeGroupVersion.WithKind("DaemonSet").GroupKind(),
+			batchv1.SchemeGroupVersion.WithKind("Job").GroupKind():
+			return true
+		}
+	}
+	return false
+}
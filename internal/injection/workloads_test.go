@@ -0,0 +1,80 @@
+package injection
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestGetCronJobOwner(t *testing.T) {
+	controller := true
+	tests := []struct {
+		name  string
+		owner *metav1.OwnerReference
+		want  bool
+	}{
+		{name: "no owner"},
+		{name: "CronJob", owner: &metav1.OwnerReference{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", Controller: &controller}, want: true},
+		{name: "CronJob v1beta1", owner: &metav1.OwnerReference{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: "report", Controller: &controller}, want: true},
+		{name: "not the controller", owner: &metav1.OwnerReference{APIVersion: "batch/v1", Kind: "CronJob", Name: "report"}},
+		{name: "CronJob of another group", owner: &metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "CronJob", Name: "report", Controller: &controller}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := newInjectableJob()
+			job.Labels = map[string]string{constants.PushgatewayLabelName: "true"}
+			if tt.owner != nil {
+				job.OwnerReferences = []metav1.OwnerReference{*tt.owner}
+			}
+
+			if got := GetCronJobOwner(job) != nil; got != tt.want {
+				t.Errorf("GetCronJobOwner() found = %t, want %t", got, tt.want)
+			}
+			// Jobs spawned by a CronJob are injected through its template, never again
+			if got := IsInjectable(job); got == tt.want {
+				t.Errorf("IsInjectable() = %t, want %t", got, !tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectCronJobRun(t *testing.T) {
+	pgw := newInjectingPushgateway(&monitoringv1alpha1.PushgatewayInjection{CronJobGroupingMode: monitoringv1alpha1.CronJobGroupingModeRun})
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "default"},
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{Spec: newInjectableJob().Spec},
+		},
+	}
+
+	if _, err := Inject(cronJob, pgw); err != nil {
+		t.Fatal(err)
+	}
+
+	env := cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env
+	runIndex, urlIndex := -1, -1
+	for i, envVar := range env {
+		switch envVar.Name {
+		case constants.PushgatewayRunEnvVar:
+			runIndex = i
+			if envVar.ValueFrom == nil || envVar.ValueFrom.FieldRef == nil ||
+				envVar.ValueFrom.FieldRef.FieldPath != "metadata.labels['job-name']" {
+				t.Errorf("%s = %+v, want the Job name label of the pod", envVar.Name, envVar)
+			}
+		case constants.PushgatewayEnvVar:
+			urlIndex = i
+		}
+	}
+	// Variables are defined before the ones referring to them
+	if runIndex < 0 || urlIndex < runIndex {
+		t.Errorf("env = %+v, want %s defined before %s", env, constants.PushgatewayRunEnvVar, constants.PushgatewayEnvVar)
+	}
+	if got, want := env[urlIndex].Value, "http://pushgateway-pushgateway:9091/metrics/job/$("+constants.PushgatewayRunEnvVar+")/cronjob/report"; got != want {
+		t.Errorf("%s = %s, want %s", constants.PushgatewayEnvVar, got, want)
+	}
+}
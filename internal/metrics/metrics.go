@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Operator metrics, exposed along the controller-runtime metrics
+var (
+	ExpiredMetricGroups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_operator_expired_metric_groups_total",
+			Help: "Number of metric groups deleted from a Pushgateway because of their retention.",
+		},
+		[]string{"namespace", "pushgateway"},
+	)
+
+	DeletedMetricGroups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_operator_deleted_metric_groups_total",
+			Help: "Number of metric groups deleted from a Pushgateway once the Job which pushed them was done.",
+		},
+		[]string{"namespace", "pushgateway"},
+	)
+
+	InjectedWorkloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_operator_injected_workloads_total",
+			Help: "Number of Jobs, CronJobs, pods and other workloads injected, by the webhook or the controllers.",
+		},
+		[]string{"namespace", "kind"},
+	)
+
+	InjectionFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_operator_injection_failures_total",
+			Help: "Number of Jobs, CronJobs, pods and other workloads which failed to be injected.",
+		},
+		[]string{"namespace", "kind"},
+	)
+
+	JobRecreateRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_operator_job_recreate_retries_total",
+			Help: "Number of times an injected Job was created again because its previous version wasn't deleted yet.",
+		},
+		[]string{"namespace"},
+	)
+
+	PrometheusBindingFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pushgateway_operator_prometheus_binding_failures_total",
+			Help: "Number of times the Prometheus a Pushgateway refers to could not be found.",
+		},
+		[]string{"namespace", "pushgateway"},
+	)
+
+	WebhookDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pushgateway_operator_webhook_duration_seconds",
+			Help:    "Time taken by the operator webhooks to answer admission requests.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"webhook", "operation", "allowed"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		ExpiredMetricGroups,
+		DeletedMetricGroups,
+		InjectedWorkloads,
+		InjectionFailures,
+		JobRecreateRetries,
+		PrometheusBindingFailures,
+		WebhookDuration,
+	)
+}
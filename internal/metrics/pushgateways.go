@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+)
+
+// Pushgateway states, from their status conditions
+const (
+	StateReady    = "ready"
+	StateDegraded = "degraded"
+	StateNotReady = "not_ready"
+)
+
+var pushgatewaysDesc = prometheus.NewDesc(
+	"pushgateway_operator_pushgateways",
+	"Number of Pushgateways by state.",
+	[]string{"state"}, nil,
+)
+
+// PushgatewayCollector counts the Pushgateways by state when scraped,
+// so deleted Pushgateways are never left behind
+type PushgatewayCollector struct {
+	Reader client.Reader
+}
+
+func (c *PushgatewayCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pushgatewaysDesc
+}
+
+func (c *PushgatewayCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pgwList := &monitoringv1alpha1.PushgatewayList{}
+	if err := c.Reader.List(ctx, pgwList); err != nil {
+		ch <- prometheus.NewInvalidMetric(pushgatewaysDesc, err)
+		return
+	}
+
+	counts := map[string]float64{StateReady: 0, StateDegraded: 0, StateNotReady: 0}
+	for i := range pgwList.Items {
+		counts[getState(&pgwList.Items[i])]++
+	}
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(pushgatewaysDesc, prometheus.GaugeValue, count, state)
+	}
+}
+
+func getState(pgw *monitoringv1alpha1.Pushgateway) string {
+	switch {
+	case meta.IsStatusConditionTrue(pgw.Status.Conditions, monitoringv1alpha1.ConditionDegraded):
+		return StateDegraded
+	case meta.IsStatusConditionTrue(pgw.Status.Conditions, monitoringv1alpha1.ConditionReady):
+		return StateReady
+	}
+	return StateNotReady
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+)
+
+func TestPushgatewayCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := monitoringv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newPushgateway("ready", metav1.Condition{Type: monitoringv1alpha1.ConditionReady, Status: metav1.ConditionTrue}),
+		newPushgateway("degraded",
+			metav1.Condition{Type: monitoringv1alpha1.ConditionReady, Status: metav1.ConditionTrue},
+			metav1.Condition{Type: monitoringv1alpha1.ConditionDegraded, Status: metav1.ConditionTrue},
+		),
+		newPushgateway("starting", metav1.Condition{Type: monitoringv1alpha1.ConditionReady, Status: metav1.ConditionFalse}),
+		newPushgateway("new"),
+	).Build()
+
+	expected := `
+# HELP pushgateway_operator_pushgateways Number of Pushgateways by state.
+# TYPE pushgateway_operator_pushgateways gauge
+pushgateway_operator_pushgateways{state="degraded"} 1
+pushgateway_operator_pushgateways{state="not_ready"} 2
+pushgateway_operator_pushgateways{state="ready"} 1
+`
+	if err := testutil.CollectAndCompare(&PushgatewayCollector{Reader: c}, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPushgatewayCollectorDeleted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := monitoringv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	pgw := newPushgateway("ready", metav1.Condition{Type: monitoringv1alpha1.ConditionReady, Status: metav1.ConditionTrue})
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pgw).Build()
+	collector := &PushgatewayCollector{Reader: c}
+
+	if err := c.Delete(context.Background(), pgw); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every state is still reported, with no Pushgateway left
+	expected := `
+# HELP pushgateway_operator_pushgateways Number of Pushgateways by state.
+# TYPE pushgateway_operator_pushgateways gauge
+pushgateway_operator_pushgateways{state="degraded"} 0
+pushgateway_operator_pushgateways{state="not_ready"} 0
+pushgateway_operator_pushgateways{state="ready"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func newPushgateway(name string, conditions ...metav1.Condition) client.Object {
+	return &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status:     monitoringv1alpha1.PushgatewayStatus{Conditions: conditions},
+	}
+}
@@ -0,0 +1,301 @@
+package pushgateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+// Client talks to the HTTP API of Pushgateways managed by the operator.
+// Secured Pushgateways are reached with the credentials of their rendered web configuration.
+type Client struct {
+	Reader     client.Reader
+	HTTPClient *http.Client
+
+	// HTTP clients of Pushgateways with TLS, reused while their CA doesn't change.
+	// Idle connections of deleted Pushgateways are closed by their transport timeout.
+	mu         sync.Mutex
+	tlsClients map[types.NamespacedName]*tlsClient
+}
+
+// tlsClient is an HTTP client verifying certificates with the CA
+type tlsClient struct {
+	ca         []byte
+	httpClient *http.Client
+}
+
+// Group is a metric group pushed to a Pushgateway, identified by its grouping key
+// and the shard holding it
+type Group struct {
+	Labels          map[string]string `json:"labels"`
+	PushTimeSeconds *MetricFamily     `json:"push_time_seconds,omitempty"`
+	Shard           int32             `json:"-"`
+}
+
+// MetricFamily is a metric of a group, as exposed by the Pushgateway API
+type MetricFamily struct {
+	Metrics []Metric `json:"metrics"`
+}
+
+type Metric struct {
+	Labels map[string]string `json:"labels"`
+	Value  string            `json:"value"`
+}
+
+// PushTime returns the time of the last successful push to the group
+func (g *Group) PushTime() (time.Time, error) {
+	if g.PushTimeSeconds == nil || len(g.PushTimeSeconds.Metrics) == 0 {
+		return time.Time{}, fmt.Errorf("metric group %s has no push_time_seconds", groupingKeyPath(g.Labels))
+	}
+
+	seconds, err := strconv.ParseFloat(g.PushTimeSeconds.Metrics[0].Value, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+}
+
+type metricsResponse struct {
+	Status string  `json:"status"`
+	Data   []Group `json:"data"`
+}
+
+func NewClient(reader client.Reader) *Client {
+	return &Client{
+		Reader:     reader,
+		HTTPClient: &http.Client{Timeout: constants.PushgatewayClientTimeout * time.Second},
+	}
+}
+
+// ShardURL returns the address the operator reaches the shard of the Pushgateway on,
+// or the Pushgateway itself when it is not sharded
+func ShardURL(pgw *monitoringv1alpha1.Pushgateway, shard int32) string {
+	host := resources.ServiceFQDN(pgw)
+	if resources.IsSharded(pgw) {
+		host = resources.ShardFQDN(pgw, shard)
+	}
+	return fmt.Sprintf("%s://%s:%d", resources.GetWebScheme(pgw), host, resources.GetPortOrDefault(pgw))
+}
+
+// ListGroups returns the metric groups currently held by every shard of the Pushgateway.
+// A group may be held by several shards, when it was pushed before shards were added or removed.
+func (c *Client) ListGroups(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) ([]Group, error) {
+	groups := []Group{}
+	for shard := int32(0); shard < resources.GetShardsOrDefault(pgw); shard++ {
+		shardGroups, err := c.listShardGroups(pgw, shard, ctx)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, shardGroups...)
+	}
+	return groups, nil
+}
+
+func (c *Client) listShardGroups(pgw *monitoringv1alpha1.Pushgateway, shard int32, ctx context.Context) ([]Group, error) {
+	resp, err := c.do(pgw, shard, http.MethodGet, constants.PushgatewayMetricsAPIPath, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing metric groups of %s returned %s", ShardURL(pgw, shard), resp.Status)
+	}
+
+	metrics := &metricsResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(metrics); err != nil {
+		return nil, err
+	}
+	if metrics.Status != "success" {
+		return nil, fmt.Errorf("listing metric groups of %s returned status %s", ShardURL(pgw, shard), metrics.Status)
+	}
+
+	for i := range metrics.Data {
+		metrics.Data[i].Shard = shard
+	}
+	return metrics.Data, nil
+}
+
+// DeleteGroup deletes the metric group from the shard holding it.
+// It does not require the admin API.
+func (c *Client) DeleteGroup(pgw *monitoringv1alpha1.Pushgateway, group *Group, ctx context.Context) error {
+	resp, err := c.do(pgw, group.Shard, http.MethodDelete, GroupPath(pgw, group.Labels), ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deleting metric group %s of %s returned %s", GroupPath(pgw, group.Labels), ShardURL(pgw, group.Shard), resp.Status)
+	}
+	return nil
+}
+
+// DeleteJobGroups deletes all the metric groups pushed under the job name,
+// whatever their other grouping labels. Returns the number of deleted groups.
+func (c *Client) DeleteJobGroups(pgw *monitoringv1alpha1.Pushgateway, job string, ctx context.Context) (int, error) {
+	groups, err := c.ListGroups(pgw, ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for i := range groups {
+		group := &groups[i]
+		if group.Labels["job"] != job {
+			continue
+		}
+		if err := c.DeleteGroup(pgw, group, ctx); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Wipe deletes all the metric groups of every shard of the Pushgateway.
+// Wiping goes through the admin API, so it is refused unless spec.enableAdminAPI is set.
+func (c *Client) Wipe(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) error {
+	if !pgw.Spec.EnableAdminAPI {
+		return fmt.Errorf("cannot wipe Pushgateway %s/%s, its admin API is not enabled", pgw.Namespace, pgw.Name)
+	}
+
+	for shard := int32(0); shard < resources.GetShardsOrDefault(pgw); shard++ {
+		resp, err := c.do(pgw, shard, http.MethodPut, constants.PushgatewayWipeAPIPath, ctx)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("wiping %s returned %s", ShardURL(pgw, shard), resp.Status)
+		}
+	}
+	return nil
+}
+
+// Sends a request to the shard of the Pushgateway, authenticated as its scrape user
+// and verifying its certificate with its CA, when its web endpoint is secured
+func (c *Client) do(pgw *monitoringv1alpha1.Pushgateway, shard int32, method string, path string, ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, ShardURL(pgw, shard)+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if pgw.Spec.Web == nil {
+		return c.HTTPClient.Do(req)
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Reader.Get(ctx, types.NamespacedName{Name: resources.WebConfigSecretName(pgw), Namespace: pgw.Namespace}, secret); err != nil {
+		return nil, err
+	}
+
+	if username, ok := secret.Data[constants.WebUsernameKey]; ok {
+		req.SetBasicAuth(string(username), string(secret.Data[constants.WebPasswordKey]))
+	}
+
+	httpClient := c.HTTPClient
+	if ca, ok := secret.Data[constants.WebCAKey]; ok && resources.IsWebTLSEnabled(pgw) {
+		httpClient, err = c.getTLSClient(pgw, ca)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CA certificate in Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	return httpClient.Do(req)
+}
+
+// getTLSClient returns the HTTP client of the Pushgateway verifying its certificate with ca.
+// The client is kept so its connections are reused, until the CA changes.
+func (c *Client) getTLSClient(pgw *monitoringv1alpha1.Pushgateway, ca []byte) (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := types.NamespacedName{Name: pgw.Name, Namespace: pgw.Namespace}
+	cached, ok := c.tlsClients[key]
+	if ok && bytes.Equal(cached.ca, ca) {
+		return cached.httpClient, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found")
+	}
+
+	// Connections verified with the previous CA are not reused
+	if ok {
+		cached.httpClient.CloseIdleConnections()
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	httpClient := &http.Client{
+		Timeout:   c.HTTPClient.Timeout,
+		Transport: transport,
+	}
+
+	if c.tlsClients == nil {
+		c.tlsClients = map[types.NamespacedName]*tlsClient{}
+	}
+	c.tlsClients[key] = &tlsClient{ca: append([]byte(nil), ca...), httpClient: httpClient}
+	return httpClient, nil
+}
+
+// GroupPath returns the path of the metric group with the grouping key,
+// under the telemetry path of the Pushgateway, as injected Jobs push to it.
+// Values which cannot be part of a path are base64 encoded.
+func GroupPath(pgw *monitoringv1alpha1.Pushgateway, groupingKey map[string]string) string {
+	return resources.GetTelemetryPathOrDefault(pgw) + groupingKeyPath(groupingKey)
+}
+
+// Returns the grouping key as a path, starting with the job label
+func groupingKeyPath(groupingKey map[string]string) string {
+	path := "/" + groupPathSegment("job", groupingKey["job"])
+
+	names := []string{}
+	for name := range groupingKey {
+		if name != "job" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path += "/" + groupPathSegment(name, groupingKey[name])
+	}
+	return path
+}
+
+func groupPathSegment(name string, value string) string {
+	// An empty value is represented by a single padding character
+	if value == "" {
+		return name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.URLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
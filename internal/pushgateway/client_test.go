@@ -0,0 +1,159 @@
+package pushgateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+)
+
+func TestGroupPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		groupingKey map[string]string
+		want        string
+	}{
+		{
+			name:        "job only",
+			groupingKey: map[string]string{"job": "backup"},
+			want:        "/metrics/job/backup",
+		},
+		{
+			name:        "labels sorted after job",
+			groupingKey: map[string]string{"zone": "eu", "job": "backup", "instance": "db-0"},
+			want:        "/metrics/job/backup/instance/db-0/zone/eu",
+		},
+		{
+			name:        "empty value",
+			groupingKey: map[string]string{"job": "backup", "instance": ""},
+			want:        "/metrics/job/backup/instance@base64/=",
+		},
+		{
+			name:        "empty job",
+			groupingKey: map[string]string{"job": ""},
+			want:        "/metrics/job@base64/=",
+		},
+		{
+			name:        "missing job",
+			groupingKey: map[string]string{},
+			want:        "/metrics/job@base64/=",
+		},
+		{
+			name:        "slash in value",
+			groupingKey: map[string]string{"job": "backup", "path": "/var/lib"},
+			want:        "/metrics/job/backup/path@base64/L3Zhci9saWI=",
+		},
+		{
+			name:        "url safe base64",
+			groupingKey: map[string]string{"job": "a/b?>"},
+			want:        "/metrics/job@base64/YS9iPz4=",
+		},
+		{
+			name:        "escaped value",
+			groupingKey: map[string]string{"job": "nightly backup"},
+			want:        "/metrics/job/nightly%20backup",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GroupPath(&monitoringv1alpha1.Pushgateway{}, tt.groupingKey); got != tt.want {
+				t.Errorf("GroupPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupPathTelemetryPath(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{Spec: monitoringv1alpha1.PushgatewaySpec{TelemetryPath: "/pushgateway"}}
+	if got, want := GroupPath(pgw, map[string]string{"job": "backup"}), "/pushgateway/job/backup"; got != want {
+		t.Errorf("GroupPath() = %s, want %s", got, want)
+	}
+}
+
+func TestWipeRequiresAdminAPI(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"}}
+	if err := NewClient(nil).Wipe(pgw, context.Background()); err == nil {
+		t.Error("Wipe() of a Pushgateway without admin API should fail")
+	}
+}
+
+func TestPushTime(t *testing.T) {
+	group := &Group{
+		Labels:          map[string]string{"job": "backup"},
+		PushTimeSeconds: &MetricFamily{Metrics: []Metric{{Value: "1.6e+09"}}},
+	}
+	got, err := group.PushTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1600000000, 0); !got.Equal(want) {
+		t.Errorf("PushTime() = %s, want %s", got, want)
+	}
+
+	if _, err := (&Group{Labels: map[string]string{"job": "backup"}}).PushTime(); err == nil {
+		t.Error("PushTime() of a group without push_time_seconds should fail")
+	}
+}
+
+func TestGetTLSClient(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"}}
+	c := NewClient(nil)
+
+	ca := newCACertificate(t)
+	first, err := c.getTLSClient(pgw, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Timeout != c.HTTPClient.Timeout {
+		t.Errorf("timeout = %s, want %s", first.Timeout, c.HTTPClient.Timeout)
+	}
+
+	// Connections are reused while the CA doesn't change
+	if again, err := c.getTLSClient(pgw, append([]byte(nil), ca...)); err != nil || again != first {
+		t.Errorf("getTLSClient() with the same CA = %p, %v, want %p", again, err, first)
+	}
+
+	rotated, err := c.getTLSClient(pgw, newCACertificate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == first {
+		t.Error("getTLSClient() with a new CA returned the previous client")
+	}
+
+	if _, err := c.getTLSClient(pgw, []byte("not a certificate")); err == nil {
+		t.Error("getTLSClient() with an invalid CA should fail")
+	}
+}
+
+// Returns a PEM encoded self-signed CA certificate
+func newCACertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,329 @@
+package pushproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+const statusPath = "/api/v1/status"
+
+// Headers which only apply to a single connection, and are not forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy replicates pushes and deletions to every Pushgateway replica,
+// so they survive the restart of any of them, and serves reads from a single replica.
+// Reads are served by the healthy replica which started first, as it holds
+// the pushes the others may have missed while restarting.
+type Proxy struct {
+	Upstreams  []*url.URL
+	HTTPClient *http.Client
+	Log        logr.Logger
+
+	mu sync.RWMutex
+	// Index of the upstream reads are served from, -1 if none is healthy
+	preferred int
+}
+
+// upstreamResponse is the buffered response of a replica to a replicated request
+type upstreamResponse struct {
+	upstream *url.URL
+	status   int
+	header   http.Header
+	body     []byte
+	err      error
+}
+
+// statusResponse is the part of the Pushgateway status API the proxy relies on
+type statusResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		StartTime time.Time `json:"start_time"`
+	} `json:"data"`
+}
+
+func New(upstreams []*url.URL, timeout time.Duration, log logr.Logger) *Proxy {
+	return &Proxy{
+		Upstreams:  upstreams,
+		HTTPClient: &http.Client{Timeout: timeout},
+		Log:        log,
+		preferred:  -1,
+	}
+}
+
+// Run refreshes the replica reads are served from at every interval, until the context is done
+func (p *Proxy) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case constants.ProxyHealthyPath:
+		w.WriteHeader(http.StatusOK)
+		return
+	case constants.ProxyReadyPath:
+		if p.getPreferred() < 0 {
+			http.Error(w, "no Pushgateway replica is healthy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPost, http.MethodDelete:
+		p.replicate(w, r)
+	default:
+		p.forward(w, r)
+	}
+}
+
+// Sends the request to every replica. The response of a replica which
+// succeeded is returned, so the push is only failed when every replica failed.
+func (p *Proxy) replicate(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Replicas are kept consistent even if the client goes away
+	ctx, cancel := context.WithTimeout(context.Background(), p.HTTPClient.Timeout)
+	defer cancel()
+
+	responses := make(chan *upstreamResponse, len(p.Upstreams))
+	for _, upstream := range p.Upstreams {
+		go func(upstream *url.URL) {
+			responses <- p.send(r, upstream, body, ctx)
+		}(upstream)
+	}
+
+	var chosen *upstreamResponse
+	for range p.Upstreams {
+		res := <-responses
+		if res.err != nil {
+			p.Log.Error(res.err, "Failed to replicate request", "method", r.Method, "path", r.URL.Path, "upstream", res.upstream.Host)
+			continue
+		}
+		if !isSuccess(res.status) {
+			p.Log.Info("Replica rejected request", "method", r.Method, "path", r.URL.Path, "upstream", res.upstream.Host, "status", res.status)
+		}
+		if chosen == nil || (!isSuccess(chosen.status) && isSuccess(res.status)) {
+			chosen = res
+		}
+	}
+
+	if chosen == nil {
+		http.Error(w, "no Pushgateway replica could be reached", http.StatusBadGateway)
+		return
+	}
+
+	copyHeader(w.Header(), chosen.header)
+	w.WriteHeader(chosen.status)
+	if _, err := w.Write(chosen.body); err != nil {
+		p.Log.Error(err, "Failed to write response")
+	}
+}
+
+func (p *Proxy) send(r *http.Request, upstream *url.URL, body []byte, ctx context.Context) *upstreamResponse {
+	res := &upstreamResponse{upstream: upstream}
+
+	req, err := newUpstreamRequest(r, upstream, bytes.NewReader(body), ctx)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer resp.Body.Close()
+
+	res.status = resp.StatusCode
+	res.header = resp.Header
+	res.body, res.err = ioutil.ReadAll(resp.Body)
+	return res
+}
+
+// Forwards the request to the preferred replica, falling back to the others
+// in order when it cannot be reached or fails with a server error
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	for _, i := range p.readOrder() {
+		upstream := p.Upstreams[i]
+		req, err := newUpstreamRequest(r, upstream, nil, r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := p.HTTPClient.Do(req)
+		if err != nil {
+			p.Log.Error(err, "Failed to forward request", "method", r.Method, "path", r.URL.Path, "upstream", upstream.Host)
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			p.Log.Info("Replica failed request", "method", r.Method, "path", r.URL.Path, "upstream", upstream.Host, "status", resp.StatusCode)
+			resp.Body.Close()
+			continue
+		}
+		defer resp.Body.Close()
+
+		copyHeader(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			p.Log.Error(err, "Failed to write response")
+		}
+		return
+	}
+
+	http.Error(w, "no Pushgateway replica could serve the request", http.StatusBadGateway)
+}
+
+// Returns the upstreams indexes reads are tried in, starting with the preferred one
+func (p *Proxy) readOrder() []int {
+	preferred := p.getPreferred()
+	order := []int{}
+	if preferred >= 0 {
+		order = append(order, preferred)
+	}
+	for i := range p.Upstreams {
+		if i != preferred {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+func (p *Proxy) getPreferred() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.preferred
+}
+
+// Elects the healthy replica which started first
+func (p *Proxy) refresh(ctx context.Context) {
+	preferred := -1
+	var preferredStart time.Time
+
+	for i, upstream := range p.Upstreams {
+		start, err := p.getStartTime(upstream, ctx)
+		if err != nil {
+			p.Log.V(1).Info("Replica is not healthy", "upstream", upstream.Host, "error", err.Error())
+			continue
+		}
+		if preferred < 0 || start.Before(preferredStart) {
+			preferred = i
+			preferredStart = start
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if preferred != p.preferred && preferred >= 0 {
+		p.Log.Info("Serving reads from replica", "upstream", p.Upstreams[preferred].Host, "started", preferredStart)
+	}
+	p.preferred = preferred
+}
+
+// Returns when the replica started, through the Pushgateway status API
+func (p *Proxy) getStartTime(upstream *url.URL, ctx context.Context) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.String()+statusPath, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("status returned %s", resp.Status)
+	}
+
+	status := &statusResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return time.Time{}, err
+	}
+	if status.Status != "success" {
+		return time.Time{}, fmt.Errorf("status returned status %s", status.Status)
+	}
+	return status.Data.StartTime, nil
+}
+
+// Builds the request to the upstream with the method, path, query and headers of the original request
+func newUpstreamRequest(r *http.Request, upstream *url.URL, body io.Reader, ctx context.Context) (*http.Request, error) {
+	target := *upstream
+	target.Path = upstream.Path + r.URL.Path
+	target.RawPath = ""
+	if r.URL.RawPath != "" {
+		target.RawPath = upstream.Path + r.URL.RawPath
+	}
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	copyHeader(req.Header, r.Header)
+	return req, nil
+}
+
+// Copies the headers, except those which only apply to a single connection
+func copyHeader(dst http.Header, src http.Header) {
+	for name, values := range src {
+		if isHopHeader(name) {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(name, value)
+		}
+	}
+}
+
+func isHopHeader(name string) bool {
+	for _, h := range hopHeaders {
+		if http.CanonicalHeaderKey(name) == h {
+			return true
+		}
+	}
+	return false
+}
+
+func isSuccess(status int) bool {
+	return status >= 200 && status < 300
+}
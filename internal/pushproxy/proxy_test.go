@@ -0,0 +1,144 @@
+package pushproxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+// upstream is a fake Pushgateway replica recording the requests it receives
+type upstream struct {
+	*httptest.Server
+	status int
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newUpstream(t *testing.T, status int) *upstream {
+	u := &upstream{status: status}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		u.mu.Lock()
+		u.requests = append(u.requests, r.Method+" "+r.URL.Path+" "+string(body))
+		u.mu.Unlock()
+		w.WriteHeader(u.status)
+		w.Write([]byte(u.URL))
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+func newProxy(t *testing.T, upstreams ...*upstream) *Proxy {
+	urls := []*url.URL{}
+	for _, u := range upstreams {
+		parsed, err := url.Parse(u.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, parsed)
+	}
+	return New(urls, time.Second, logr.Discard())
+}
+
+func TestReplicate(t *testing.T) {
+	ok := newUpstream(t, http.StatusOK)
+	failing := newUpstream(t, http.StatusInternalServerError)
+	down := newUpstream(t, http.StatusOK)
+	down.Close()
+
+	tests := []struct {
+		name       string
+		upstreams  []*upstream
+		wantStatus int
+	}{
+		{name: "one replica succeeds", upstreams: []*upstream{failing, down, ok}, wantStatus: http.StatusOK},
+		{name: "every replica fails", upstreams: []*upstream{failing}, wantStatus: http.StatusInternalServerError},
+		{name: "no replica reachable", upstreams: []*upstream{down}, wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProxy(t, tt.upstreams...)
+			req := httptest.NewRequest(http.MethodPut, "/metrics/job/backup", strings.NewReader("backup_success 1\n"))
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	for _, u := range []*upstream{ok, failing} {
+		u.mu.Lock()
+		if len(u.requests) == 0 || u.requests[0] != "PUT /metrics/job/backup backup_success 1\n" {
+			t.Errorf("replica %s received %q, want the push", u.URL, u.requests)
+		}
+		u.mu.Unlock()
+	}
+}
+
+func TestForward(t *testing.T) {
+	ok := newUpstream(t, http.StatusOK)
+	failing := newUpstream(t, http.StatusServiceUnavailable)
+	notFound := newUpstream(t, http.StatusNotFound)
+	down := newUpstream(t, http.StatusOK)
+	down.Close()
+
+	tests := []struct {
+		name       string
+		upstreams  []*upstream
+		preferred  int
+		wantStatus int
+		wantFrom   *upstream
+	}{
+		{name: "preferred replica", upstreams: []*upstream{failing, ok}, preferred: 1, wantStatus: http.StatusOK, wantFrom: ok},
+		{name: "preferred replica down", upstreams: []*upstream{down, ok}, preferred: 0, wantStatus: http.StatusOK, wantFrom: ok},
+		{name: "preferred replica failing", upstreams: []*upstream{failing, ok}, preferred: 0, wantStatus: http.StatusOK, wantFrom: ok},
+		{name: "client error returned", upstreams: []*upstream{notFound, ok}, preferred: 0, wantStatus: http.StatusNotFound, wantFrom: notFound},
+		{name: "every replica failing", upstreams: []*upstream{failing, down}, preferred: -1, wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProxy(t, tt.upstreams...)
+			p.preferred = tt.preferred
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantFrom != nil && rec.Body.String() != tt.wantFrom.URL {
+				t.Errorf("served by %s, want %s", rec.Body.String(), tt.wantFrom.URL)
+			}
+		})
+	}
+}
+
+func TestReady(t *testing.T) {
+	p := newProxy(t, newUpstream(t, http.StatusOK))
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constants.ProxyReadyPath, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status without healthy replica = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	p.preferred = 0
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constants.ProxyReadyPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status with a healthy replica = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
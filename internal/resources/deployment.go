@@ -5,6 +5,7 @@ import (
 
 	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
 	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,17 +16,21 @@ func DeploymentName(pgw *monitoringv1alpha1.Pushgateway) string {
 }
 
 // Creates a deployment for the Pushgateway
-// TODO: add requests/limits
 func PushgatewayDeployment(pgw *monitoringv1alpha1.Pushgateway) *appsv1.Deployment {
 	replicas := int32(1)
 	if pgw.Spec.Replicas > 0 {
 		replicas = pgw.Spec.Replicas
 	}
 
-	container := PushgatewayContainer(pgw)
+	strategy := appsv1.DeploymentStrategy{}
 
-	labels := PushgatewayLabels(pgw)
+	// Only a single pod may write the persistence file at a time
+	if pgw.Spec.Persistence != nil {
+		replicas = 1
+		strategy.Type = appsv1.RecreateDeploymentStrategyType
+	}
 
+	labels := PushgatewayLabels(pgw)
 	dep := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            DeploymentName(pgw),
@@ -37,21 +42,65 @@ func PushgatewayDeployment(pgw *monitoringv1alpha1.Pushgateway) *appsv1.Deployme
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{*container},
-				},
-			},
+			Template: PushgatewayPodTemplate(pgw),
 			Replicas: &replicas,
+			Strategy: strategy,
 		},
 	}
 
 	return dep
 }
 
+// Creates the pod template of the Pushgateway Deployment or StatefulSet
+func PushgatewayPodTemplate(pgw *monitoringv1alpha1.Pushgateway) corev1.PodTemplateSpec {
+	container := PushgatewayContainer(pgw)
+
+	labels := PushgatewayLabels(pgw)
+
+	podSpec := corev1.PodSpec{
+		Containers:                []corev1.Container{*container},
+		NodeSelector:              pgw.Spec.NodeSelector,
+		Tolerations:               pgw.Spec.Tolerations,
+		Affinity:                  pgw.Spec.Affinity,
+		TopologySpreadConstraints: pgw.Spec.TopologySpreadConstraints,
+		PriorityClassName:         pgw.Spec.PriorityClassName,
+		SecurityContext:           PushgatewayPodSecurityContext(pgw),
+		ImagePullSecrets:          pgw.Spec.ImagePullSecrets,
+		ServiceAccountName:        pgw.Spec.ServiceAccountName,
+	}
+
+	if pgw.Spec.Persistence != nil {
+		// The volume must be writable by the Pushgateway user
+		if podSpec.SecurityContext.FSGroup == nil {
+			fsGroup := int64(constants.PersistenceFSGroup)
+			podSpec.SecurityContext.FSGroup = &fsGroup
+		}
+		podSpec.Volumes = []corev1.Volume{
+			{
+				Name: constants.PersistenceVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: PersistentVolumeClaimName(pgw),
+					},
+				},
+			},
+		}
+	}
+
+	if pgw.Spec.Web != nil {
+		podSpec.Volumes = append(podSpec.Volumes, PushgatewayWebConfigVolume(pgw))
+	}
+
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			// Labels selected by the Deployment or StatefulSet take precedence
+			Labels:      util.MergeLabels(pgw.Spec.PodLabels, labels),
+			Annotations: pgw.Spec.PodAnnotations,
+		},
+		Spec: podSpec,
+	}
+}
+
 // Creates a container for the Pushgateway
 func PushgatewayContainer(pgw *monitoringv1alpha1.Pushgateway) *corev1.Container {
 	image := pgw.Status.Image
@@ -67,16 +116,71 @@ func PushgatewayContainer(pgw *monitoringv1alpha1.Pushgateway) *corev1.Container
 				ContainerPort: port,
 			},
 		},
+		Resources:       pgw.Spec.Resources,
+		SecurityContext: PushgatewaySecurityContext(pgw),
+	}
+
+	if pgw.Spec.Persistence != nil {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      constants.PersistenceVolumeName,
+			MountPath: constants.PersistenceMountPath,
+		})
+	}
+
+	if pgw.Spec.Web != nil {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      constants.WebConfigVolumeName,
+			MountPath: constants.WebConfigMountPath,
+			ReadOnly:  true,
+		})
 	}
 	return container
 }
 
+// Sets the pod security context through spec.PodSecurityContext or
+// defaults to running as nobody with the RuntimeDefault seccomp profile
+func PushgatewayPodSecurityContext(pgw *monitoringv1alpha1.Pushgateway) *corev1.PodSecurityContext {
+	if pgw.Spec.PodSecurityContext != nil {
+		return pgw.Spec.PodSecurityContext.DeepCopy()
+	}
+
+	trueVar := true
+	user := int64(constants.RunAsUser)
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: &trueVar,
+		RunAsUser:    &user,
+		RunAsGroup:   &user,
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// Sets the container security context through spec.SecurityContext or
+// defaults to a non-root, read-only and unprivileged container
+func PushgatewaySecurityContext(pgw *monitoringv1alpha1.Pushgateway) *corev1.SecurityContext {
+	if pgw.Spec.SecurityContext != nil {
+		return pgw.Spec.SecurityContext.DeepCopy()
+	}
+
+	trueVar := true
+	falseVar := false
+	return &corev1.SecurityContext{
+		RunAsNonRoot:             &trueVar,
+		ReadOnlyRootFilesystem:   &trueVar,
+		AllowPrivilegeEscalation: &falseVar,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+	}
+}
+
 func getPushgatewayArgs(pgw *monitoringv1alpha1.Pushgateway, port int32) []string {
 	arg := fmt.Sprintf("%s:%d", constants.ListenAddressArg, port)
 	args := []string{arg}
 
 	if pgw.Spec.TelemetryPath != "" {
-		arg = GetTelemetryPathOrDefault(pgw)
+		arg = fmt.Sprintf("%s%s", constants.TelemetryPathArg, GetTelemetryPathOrDefault(pgw))
 		args = append(args, arg)
 	}
 
@@ -98,5 +202,20 @@ func getPushgatewayArgs(pgw *monitoringv1alpha1.Pushgateway, port int32) []strin
 		args = append(args, arg)
 	}
 
+	if persistence := pgw.Spec.Persistence; persistence != nil {
+		arg = fmt.Sprintf("%s%s", constants.PersistenceFileArg, constants.PersistenceFile)
+		args = append(args, arg)
+
+		if persistence.Interval != nil {
+			arg = fmt.Sprintf("%s%s", constants.PersistenceIntArg, persistence.Interval.Duration)
+			args = append(args, arg)
+		}
+	}
+
+	if pgw.Spec.Web != nil {
+		arg = fmt.Sprintf("%s%s", constants.WebConfigFileArg, webConfigPath(constants.WebConfigKey))
+		args = append(args, arg)
+	}
+
 	return args
 }
@@ -0,0 +1,113 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestPushgatewayPodTemplateOverrides(t *testing.T) {
+	pgw := newPushgateway()
+	pgw.Labels = map[string]string{"team": "jobs"}
+	pgw.Spec.Resources = corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+	}
+	pgw.Spec.NodeSelector = map[string]string{"node-role": "monitoring"}
+	pgw.Spec.Tolerations = []corev1.Toleration{{Key: "monitoring", Operator: corev1.TolerationOpExists}}
+	pgw.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}}
+	pgw.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{MaxSkew: 1, TopologyKey: "zone"}}
+	pgw.Spec.PriorityClassName = "monitoring"
+	pgw.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
+	pgw.Spec.ServiceAccountName = "pushgateway"
+	pgw.Spec.PodAnnotations = map[string]string{"example.com/scrape": "false"}
+	// The team label is selected by the workload and cannot be overridden
+	pgw.Spec.PodLabels = map[string]string{"tier": "monitoring", "team": "other"}
+
+	template := PushgatewayPodTemplate(pgw)
+	spec := template.Spec
+
+	if !reflect.DeepEqual(spec.NodeSelector, pgw.Spec.NodeSelector) {
+		t.Errorf("nodeSelector = %v, want %v", spec.NodeSelector, pgw.Spec.NodeSelector)
+	}
+	if !reflect.DeepEqual(spec.Tolerations, pgw.Spec.Tolerations) {
+		t.Errorf("tolerations = %v, want %v", spec.Tolerations, pgw.Spec.Tolerations)
+	}
+	if spec.Affinity != pgw.Spec.Affinity {
+		t.Errorf("affinity = %v, want %v", spec.Affinity, pgw.Spec.Affinity)
+	}
+	if !reflect.DeepEqual(spec.TopologySpreadConstraints, pgw.Spec.TopologySpreadConstraints) {
+		t.Errorf("topologySpreadConstraints = %v, want %v", spec.TopologySpreadConstraints, pgw.Spec.TopologySpreadConstraints)
+	}
+	if spec.PriorityClassName != "monitoring" {
+		t.Errorf("priorityClassName = %q, want monitoring", spec.PriorityClassName)
+	}
+	if !reflect.DeepEqual(spec.ImagePullSecrets, pgw.Spec.ImagePullSecrets) {
+		t.Errorf("imagePullSecrets = %v, want %v", spec.ImagePullSecrets, pgw.Spec.ImagePullSecrets)
+	}
+	if spec.ServiceAccountName != "pushgateway" {
+		t.Errorf("serviceAccountName = %q, want pushgateway", spec.ServiceAccountName)
+	}
+	if !reflect.DeepEqual(template.Annotations, pgw.Spec.PodAnnotations) {
+		t.Errorf("annotations = %v, want %v", template.Annotations, pgw.Spec.PodAnnotations)
+	}
+	if template.Labels["tier"] != "monitoring" || template.Labels["team"] != "jobs" {
+		t.Errorf("labels = %v, want tier=monitoring and team=jobs", template.Labels)
+	}
+	if !reflect.DeepEqual(spec.Containers[0].Resources, pgw.Spec.Resources) {
+		t.Errorf("resources = %v, want %v", spec.Containers[0].Resources, pgw.Spec.Resources)
+	}
+}
+
+func TestPushgatewaySecurityContextDefaults(t *testing.T) {
+	spec := PushgatewayPodTemplate(newPushgateway()).Spec
+
+	pod := spec.SecurityContext
+	if pod.RunAsNonRoot == nil || !*pod.RunAsNonRoot {
+		t.Error("pod may run as root")
+	}
+	if pod.RunAsUser == nil || *pod.RunAsUser != constants.RunAsUser {
+		t.Errorf("pod runAsUser = %v, want %d", pod.RunAsUser, constants.RunAsUser)
+	}
+	if pod.SeccompProfile == nil || pod.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("pod seccompProfile = %v, want RuntimeDefault", pod.SeccompProfile)
+	}
+
+	container := spec.Containers[0].SecurityContext
+	if container.RunAsNonRoot == nil || !*container.RunAsNonRoot {
+		t.Error("container may run as root")
+	}
+	if container.ReadOnlyRootFilesystem == nil || !*container.ReadOnlyRootFilesystem {
+		t.Error("container root filesystem is writable")
+	}
+	if container.AllowPrivilegeEscalation == nil || *container.AllowPrivilegeEscalation {
+		t.Error("container allows privilege escalation")
+	}
+	if container.Capabilities == nil || !reflect.DeepEqual(container.Capabilities.Drop, []corev1.Capability{"ALL"}) {
+		t.Errorf("container capabilities = %v, want all dropped", container.Capabilities)
+	}
+}
+
+func TestPushgatewaySecurityContextOverrides(t *testing.T) {
+	user := int64(1000)
+	falseVar := false
+	pgw := newPushgateway()
+	pgw.Spec.PodSecurityContext = &corev1.PodSecurityContext{RunAsUser: &user}
+	pgw.Spec.SecurityContext = &corev1.SecurityContext{ReadOnlyRootFilesystem: &falseVar}
+
+	spec := PushgatewayPodTemplate(pgw).Spec
+
+	if !reflect.DeepEqual(spec.SecurityContext, pgw.Spec.PodSecurityContext) {
+		t.Errorf("pod security context = %v, want %v", spec.SecurityContext, pgw.Spec.PodSecurityContext)
+	}
+	if !reflect.DeepEqual(spec.Containers[0].SecurityContext, pgw.Spec.SecurityContext) {
+		t.Errorf("container security context = %v, want %v", spec.Containers[0].SecurityContext, pgw.Spec.SecurityContext)
+	}
+	// The override is copied, so defaulting the fsGroup never mutates the spec
+	if spec.SecurityContext == pgw.Spec.PodSecurityContext {
+		t.Error("pod security context shares the Pushgateway spec")
+	}
+}
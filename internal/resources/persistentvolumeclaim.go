@@ -0,0 +1,49 @@
+package resources
+
+import (
+	"fmt"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func PersistentVolumeClaimName(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s%s", pgw.Name, constants.PVCSuffix)
+}
+
+// Creates a PersistentVolumeClaim to hold the Pushgateway persistence file
+func PushgatewayPersistentVolumeClaim(pgw *monitoringv1alpha1.Pushgateway) *corev1.PersistentVolumeClaim {
+	persistence := pgw.Spec.Persistence
+
+	size := resource.MustParse(constants.DefaultPersistenceSize)
+	if persistence.Size != nil {
+		size = *persistence.Size
+	}
+
+	accessMode := corev1.ReadWriteOnce
+	if persistence.AccessMode != "" {
+		accessMode = persistence.AccessMode
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            PersistentVolumeClaimName(pgw),
+			Namespace:       pgw.Namespace,
+			Labels:          PushgatewayLabels(pgw),
+			OwnerReferences: SetOwnerReference(pgw),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{accessMode},
+			StorageClassName: persistence.StorageClassName,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	return pvc
+}
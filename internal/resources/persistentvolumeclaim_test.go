@@ -0,0 +1,115 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestPushgatewayPersistentVolumeClaim(t *testing.T) {
+	storageClass := "fast"
+	size := resource.MustParse("5Gi")
+
+	tests := []struct {
+		name             string
+		persistence      *monitoringv1alpha1.PushgatewayPersistence
+		wantSize         string
+		wantAccessMode   corev1.PersistentVolumeAccessMode
+		wantStorageClass *string
+	}{
+		{
+			name:           "defaults",
+			persistence:    &monitoringv1alpha1.PushgatewayPersistence{},
+			wantSize:       constants.DefaultPersistenceSize,
+			wantAccessMode: corev1.ReadWriteOnce,
+		},
+		{
+			name: "overrides",
+			persistence: &monitoringv1alpha1.PushgatewayPersistence{
+				StorageClassName: &storageClass,
+				Size:             &size,
+				AccessMode:       corev1.ReadWriteOncePod,
+			},
+			wantSize:         "5Gi",
+			wantAccessMode:   corev1.ReadWriteOncePod,
+			wantStorageClass: &storageClass,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := newPushgateway()
+			pgw.Spec.Persistence = tt.persistence
+
+			pvc := PushgatewayPersistentVolumeClaim(pgw)
+			if pvc.Name != "pushgateway-pushgateway" || pvc.Namespace != "default" {
+				t.Errorf("PersistentVolumeClaim name = %s/%s, want default/pushgateway-pushgateway", pvc.Namespace, pvc.Name)
+			}
+			if got := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse(tt.wantSize)) != 0 {
+				t.Errorf("size = %s, want %s", got.String(), tt.wantSize)
+			}
+			if !reflect.DeepEqual(pvc.Spec.AccessModes, []corev1.PersistentVolumeAccessMode{tt.wantAccessMode}) {
+				t.Errorf("access modes = %v, want [%s]", pvc.Spec.AccessModes, tt.wantAccessMode)
+			}
+			if !reflect.DeepEqual(pvc.Spec.StorageClassName, tt.wantStorageClass) {
+				t.Errorf("storage class = %v, want %v", pvc.Spec.StorageClassName, tt.wantStorageClass)
+			}
+		})
+	}
+}
+
+func TestPushgatewayDeploymentPersistence(t *testing.T) {
+	pgw := newPushgateway()
+	pgw.Spec.Replicas = 3
+	pgw.Spec.Persistence = &monitoringv1alpha1.PushgatewayPersistence{
+		Interval: &metav1.Duration{Duration: 10 * time.Second},
+	}
+
+	dep := PushgatewayDeployment(pgw)
+
+	// Only a single pod may write the persistence file at a time
+	if *dep.Spec.Replicas != 1 {
+		t.Errorf("replicas = %d, want 1", *dep.Spec.Replicas)
+	}
+	if dep.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		t.Errorf("strategy = %s, want Recreate", dep.Spec.Strategy.Type)
+	}
+
+	podSpec := dep.Spec.Template.Spec
+	wantVolume := corev1.Volume{
+		Name: constants.PersistenceVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pushgateway-pushgateway"},
+		},
+	}
+	if !reflect.DeepEqual(podSpec.Volumes, []corev1.Volume{wantVolume}) {
+		t.Errorf("volumes = %v, want %v", podSpec.Volumes, []corev1.Volume{wantVolume})
+	}
+	if podSpec.SecurityContext.FSGroup == nil || *podSpec.SecurityContext.FSGroup != constants.PersistenceFSGroup {
+		t.Errorf("fsGroup = %v, want %d", podSpec.SecurityContext.FSGroup, constants.PersistenceFSGroup)
+	}
+
+	container := podSpec.Containers[0]
+	wantMount := corev1.VolumeMount{Name: constants.PersistenceVolumeName, MountPath: constants.PersistenceMountPath}
+	if !reflect.DeepEqual(container.VolumeMounts, []corev1.VolumeMount{wantMount}) {
+		t.Errorf("volume mounts = %v, want %v", container.VolumeMounts, []corev1.VolumeMount{wantMount})
+	}
+	wantArgs := []string{"--web.listen-address=:9091", "--persistence.file=/data/metrics", "--persistence.interval=10s"}
+	if !reflect.DeepEqual(container.Args, wantArgs) {
+		t.Errorf("args = %v, want %v", container.Args, wantArgs)
+	}
+}
+
+func newPushgateway() *monitoringv1alpha1.Pushgateway {
+	return &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+	}
+}
@@ -0,0 +1,78 @@
+package resources
+
+import (
+	"fmt"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func PodMonitorName(name string) string {
+	return fmt.Sprintf("%s%s", name, constants.PodMonitorSuffix)
+}
+
+// Creates a PodMonitor scraping every Pushgateway pod directly.
+// Each pod gets its own instance label, so replicas can be told apart.
+func PushgatewayPodMonitor(pgw *monitoringv1alpha1.Pushgateway) *monitoringv1.PodMonitor {
+	truevar := true
+	labels := PrometheusSelectedLabels(pgw, pgw.Status.PrometheusPodMonitorSelector)
+
+	metadata := metav1.ObjectMeta{
+		Name:      PodMonitorName(pgw.Name),
+		Namespace: PodMonitorNamespace(pgw),
+		Labels:    util.MergeLabels(labels, OwnerLabels(pgw)),
+	}
+
+	// Owner references cannot cross namespaces,
+	// PodMonitors in other namespaces are cleaned up by the finalizer
+	namespaceSelector := monitoringv1.NamespaceSelector{}
+	if metadata.Namespace == pgw.Namespace {
+		metadata.OwnerReferences = SetOwnerReference(pgw)
+	} else {
+		namespaceSelector.MatchNames = []string{pgw.Namespace}
+	}
+
+	endpoint := monitoringv1.PodMetricsEndpoint{
+		Port:            constants.PortName,
+		Scheme:          GetWebScheme(pgw),
+		Path:            GetTelemetryPathOrDefault(pgw),
+		HonorLabels:     true,
+		HonorTimestamps: &truevar,
+		RelabelConfigs: []*monitoringv1.RelabelConfig{
+			{
+				SourceLabels: []string{"__meta_kubernetes_pod_name"},
+				TargetLabel:  "instance",
+			},
+		},
+		BasicAuth: scrapeBasicAuth(pgw),
+	}
+
+	if tlsConfig := scrapeTLSConfig(pgw); tlsConfig != nil {
+		endpoint.TLSConfig = &monitoringv1.PodMetricsEndpointTLSConfig{SafeTLSConfig: *tlsConfig}
+	}
+
+	podmon := &monitoringv1.PodMonitor{
+		ObjectMeta: metadata,
+		Spec: monitoringv1.PodMonitorSpec{
+			Selector: metav1.LabelSelector{
+				MatchLabels: ServedLabels(pgw),
+			},
+			NamespaceSelector:   namespaceSelector,
+			PodMetricsEndpoints: []monitoringv1.PodMetricsEndpoint{endpoint},
+		},
+	}
+
+	return podmon
+}
+
+// PodMonitorNamespace returns the namespace the PodMonitor is created in.
+// Defaults to the Pushgateway namespace.
+func PodMonitorNamespace(pgw *monitoringv1alpha1.Pushgateway) string {
+	if pgw.Status.PodMonitorNamespace != "" {
+		return pgw.Status.PodMonitorNamespace
+	}
+	return pgw.Namespace
+}
@@ -0,0 +1,69 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestPushgatewayPodMonitor(t *testing.T) {
+	tests := []struct {
+		name           string
+		namespace      string
+		wantNamespace  string
+		wantOwned      bool
+		wantMatchNames []string
+	}{
+		{name: "Pushgateway namespace", wantNamespace: "default", wantOwned: true},
+		{name: "other namespace", namespace: "monitoring", wantNamespace: "monitoring", wantMatchNames: []string{"default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := newPushgateway()
+			pgw.Status.PodMonitorNamespace = tt.namespace
+			pgw.Status.PrometheusPodMonitorSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"release": "k8s"}}
+
+			podmon := PushgatewayPodMonitor(pgw)
+
+			if podmon.Name != "pushgateway-pushgateway" || podmon.Namespace != tt.wantNamespace {
+				t.Errorf("PodMonitor name = %s/%s, want %s/pushgateway-pushgateway", podmon.Namespace, podmon.Name, tt.wantNamespace)
+			}
+			if owned := len(podmon.OwnerReferences) > 0; owned != tt.wantOwned {
+				t.Errorf("owned = %t, want %t", owned, tt.wantOwned)
+			}
+			if !reflect.DeepEqual(podmon.Spec.NamespaceSelector.MatchNames, tt.wantMatchNames) {
+				t.Errorf("namespace selector = %v, want %v", podmon.Spec.NamespaceSelector.MatchNames, tt.wantMatchNames)
+			}
+			for name, value := range map[string]string{
+				"release":                         "k8s",
+				constants.OwnerNameLabelName:      "pushgateway",
+				constants.OwnerNamespaceLabelName: "default",
+			} {
+				if podmon.Labels[name] != value {
+					t.Errorf("label %s = %q, want %q", name, podmon.Labels[name], value)
+				}
+			}
+			if !reflect.DeepEqual(podmon.Spec.Selector.MatchLabels, map[string]string(PushgatewayLabels(pgw))) {
+				t.Errorf("selector = %v, want %v", podmon.Spec.Selector.MatchLabels, PushgatewayLabels(pgw))
+			}
+
+			if len(podmon.Spec.PodMetricsEndpoints) != 1 {
+				t.Fatalf("endpoints = %d, want 1", len(podmon.Spec.PodMetricsEndpoints))
+			}
+			endpoint := podmon.Spec.PodMetricsEndpoints[0]
+			if endpoint.Port != constants.PortName || endpoint.Path != constants.DefaultTelemetryPath || endpoint.Scheme != "http" {
+				t.Errorf("endpoint = %s %s %s, want web /metrics http", endpoint.Port, endpoint.Path, endpoint.Scheme)
+			}
+			if !endpoint.HonorLabels || endpoint.HonorTimestamps == nil || !*endpoint.HonorTimestamps {
+				t.Error("endpoint does not honor pushed labels and timestamps")
+			}
+			if len(endpoint.RelabelConfigs) != 1 || endpoint.RelabelConfigs[0].TargetLabel != "instance" {
+				t.Errorf("relabel configs = %v, want pod name as instance", endpoint.RelabelConfigs)
+			}
+		})
+	}
+}
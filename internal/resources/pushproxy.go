@@ -0,0 +1,196 @@
+package resources
+
+import (
+	"fmt"
+	"strings"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func ProxyDeploymentName(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s%s", pgw.Name, constants.ProxySuffix)
+}
+
+// ReplicasServiceName returns the name of the headless Service
+// publishing the DNS names of the replicas in high availability mode
+func ReplicasServiceName(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s%s", pgw.Name, constants.ReplicasSuffix)
+}
+
+// IsHighlyAvailable returns whether the Pushgateway runs its replicas behind a push proxy
+func IsHighlyAvailable(pgw *monitoringv1alpha1.Pushgateway) bool {
+	return pgw.Spec.HighAvailability != nil
+}
+
+// ReplicaLabels are the labels of the Pushgateway replicas in high availability mode
+func ReplicaLabels(pgw *monitoringv1alpha1.Pushgateway) map[string]string {
+	return util.MergeLabels(PushgatewayLabels(pgw), map[string]string{constants.ComponentLabelName: constants.ComponentReplica})
+}
+
+// ProxyLabels are the labels of the push proxy in high availability mode
+func ProxyLabels(pgw *monitoringv1alpha1.Pushgateway) map[string]string {
+	return util.MergeLabels(PushgatewayLabels(pgw), map[string]string{constants.ComponentLabelName: constants.ComponentProxy})
+}
+
+// ServedLabels are the labels of the pods the Service targets and monitors scrape:
+// the push proxy in high availability mode, or the Pushgateway pods
+func ServedLabels(pgw *monitoringv1alpha1.Pushgateway) map[string]string {
+	if IsHighlyAvailable(pgw) {
+		return ProxyLabels(pgw)
+	}
+	return PushgatewayLabels(pgw)
+}
+
+// Sets the push proxy image through spec.highAvailability.proxyImage or default image
+func GetProxyImageOrDefault(pgw *monitoringv1alpha1.Pushgateway, defaultImage string) string {
+	if pgw.Spec.HighAvailability != nil && pgw.Spec.HighAvailability.ProxyImage != "" {
+		return pgw.Spec.HighAvailability.ProxyImage
+	}
+	return defaultImage
+}
+
+// Sets the push proxy replicas through spec.highAvailability.proxyReplicas or default to 1
+func GetProxyReplicasOrDefault(pgw *monitoringv1alpha1.Pushgateway) int32 {
+	if pgw.Spec.HighAvailability != nil && pgw.Spec.HighAvailability.ProxyReplicas > 0 {
+		return pgw.Spec.HighAvailability.ProxyReplicas
+	}
+	return 1
+}
+
+// Spreads the pods with the labels across nodes, unless spec.topologySpreadConstraints is set.
+// Pods are still scheduled on clusters with fewer nodes than replicas.
+func GetSpreadConstraintsOrDefault(pgw *monitoringv1alpha1.Pushgateway, labels map[string]string) []corev1.TopologySpreadConstraint {
+	if len(pgw.Spec.TopologySpreadConstraints) > 0 {
+		return pgw.Spec.TopologySpreadConstraints
+	}
+	return []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           1,
+			TopologyKey:       corev1.LabelHostname,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+		},
+	}
+}
+
+// Returns the addresses of the Pushgateway replicas the push proxy replicates to
+func ReplicaURLs(pgw *monitoringv1alpha1.Pushgateway) []string {
+	urls := []string{}
+	for i := int32(0); i < GetReplicasOrDefault(pgw); i++ {
+		host := fmt.Sprintf("%s-%d.%s.%s.svc", StatefulSetName(pgw), i, ReplicasServiceName(pgw), pgw.Namespace)
+		urls = append(urls, fmt.Sprintf("%s://%s:%d", GetWebScheme(pgw), host, GetPortOrDefault(pgw)))
+	}
+	return urls
+}
+
+// Creates the headless Service publishing the DNS names of the replicas
+func PushgatewayReplicasService(pgw *monitoringv1alpha1.Pushgateway) *corev1.Service {
+	labels := ReplicaLabels(pgw)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ReplicasServiceName(pgw),
+			Namespace:       pgw.Namespace,
+			Labels:          labels,
+			OwnerReferences: SetOwnerReference(pgw),
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       constants.PortName,
+					Port:       GetPortOrDefault(pgw),
+					TargetPort: intstr.FromString(constants.PortName),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+			Selector:  labels,
+			ClusterIP: "None",
+			// The proxy elects the replica reads are served from by itself
+			PublishNotReadyAddresses: true,
+		},
+	}
+	return svc
+}
+
+// Creates a deployment for the push proxy. It is never scaled down
+// before its new replicas are ready, so pushes are not refused during rollouts.
+func PushgatewayProxyDeployment(pgw *monitoringv1alpha1.Pushgateway, image string) *appsv1.Deployment {
+	replicas := GetProxyReplicasOrDefault(pgw)
+	port := GetPortOrDefault(pgw)
+	labels := ProxyLabels(pgw)
+	maxUnavailable := intstr.FromInt(0)
+
+	container := corev1.Container{
+		Name:  constants.ProxyContainerName,
+		Image: image,
+		Args: []string{
+			fmt.Sprintf("%s:%d", constants.ProxyListenAddressArg, port),
+			fmt.Sprintf("%s%s", constants.ProxyUpstreamsArg, strings.Join(ReplicaURLs(pgw), ",")),
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          constants.PortName,
+				ContainerPort: port,
+			},
+		},
+		ReadinessProbe: &corev1.Probe{
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{Path: constants.ProxyReadyPath, Port: intstr.FromString(constants.PortName)},
+			},
+		},
+		LivenessProbe: &corev1.Probe{
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{Path: constants.ProxyHealthyPath, Port: intstr.FromString(constants.PortName)},
+			},
+		},
+		Resources:       pgw.Spec.HighAvailability.ProxyResources,
+		SecurityContext: PushgatewaySecurityContext(pgw),
+	}
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ProxyDeploymentName(pgw),
+			Namespace:       pgw.Namespace,
+			Labels:          labels,
+			OwnerReferences: SetOwnerReference(pgw),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      util.MergeLabels(pgw.Spec.PodLabels, labels),
+					Annotations: pgw.Spec.PodAnnotations,
+				},
+				Spec: corev1.PodSpec{
+					Containers:                []corev1.Container{container},
+					NodeSelector:              pgw.Spec.NodeSelector,
+					Tolerations:               pgw.Spec.Tolerations,
+					Affinity:                  pgw.Spec.Affinity,
+					TopologySpreadConstraints: GetSpreadConstraintsOrDefault(pgw, labels),
+					PriorityClassName:         pgw.Spec.PriorityClassName,
+					SecurityContext:           PushgatewayPodSecurityContext(pgw),
+					ImagePullSecrets:          pgw.Spec.ImagePullSecrets,
+					ServiceAccountName:        pgw.Spec.ServiceAccountName,
+				},
+			},
+			Replicas: &replicas,
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
+					MaxUnavailable: &maxUnavailable,
+				},
+			},
+		},
+	}
+
+	return dep
+}
@@ -14,9 +14,15 @@ func ServiceName(pgw *monitoringv1alpha1.Pushgateway) string {
 	return fmt.Sprintf("%s%s", pgw.Name, constants.ServiceSuffix)
 }
 
+// ServiceFQDN returns the fully qualified host of the Pushgateway Service,
+// reachable from any namespace
+func ServiceFQDN(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s.%s.svc", ServiceName(pgw), pgw.Namespace)
+}
+
 func PushgatewayService(pgw *monitoringv1alpha1.Pushgateway) *corev1.Service {
 	port := GetPortOrDefault(pgw)
-	labels := PushgatewayLabels(pgw)
+	labels := ServedLabels(pgw)
 	svc := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            ServiceName(pgw),
@@ -2,7 +2,6 @@ package resources
 
 import (
 	"fmt"
-	"time"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
@@ -17,54 +16,55 @@ func ServiceMonitorName(name string) string {
 
 func PushgatewayServiceMonitor(pgw *monitoringv1alpha1.Pushgateway) *monitoringv1.ServiceMonitor {
 	truevar := true
-	labels := PushgatewayLabels(pgw)
+	labels := PrometheusSelectedLabels(pgw, pgw.Status.PrometheusServiceMonitorSelector)
 
-	// Find linked Prometheus instance label selector and merge it to the labels
-	if promSmSelector := pgw.Status.PrometheusServiceMonitorSelector; promSmSelector != nil && pgw.Status.Prometheus != "N/A" {
-		// Add labels under MatchLabels
-		labels = util.MergeLabels(labels, promSmSelector.MatchLabels)
-
-		//Iterate over MatchExpressions and make sure the labels match
-		labels = HandleMatchExpressions(labels, promSmSelector.MatchExpressions)
+	metadata := metav1.ObjectMeta{
+		Name:      ServiceMonitorName(pgw.Name),
+		Namespace: ServiceMonitorNamespace(pgw),
+		Labels:    util.MergeLabels(labels, OwnerLabels(pgw)),
 	}
 
-	/*
-		TODO: Support creating ServiceMonitor in different namespace according
-		to Prometheus' ServiceMonitorNamespaceSelector
-
-		TODO: Support PodMonitor
-	*/
-	metadata := metav1.ObjectMeta{
-		Name:            ServiceMonitorName(pgw.Name),
-		Namespace:       pgw.Namespace,
-		Labels:          labels,
-		OwnerReferences: SetOwnerReference(pgw),
+	// Owner references cannot cross namespaces,
+	// ServiceMonitors in other namespaces are cleaned up by the finalizer
+	namespaceSelector := monitoringv1.NamespaceSelector{}
+	if metadata.Namespace == pgw.Namespace {
+		metadata.OwnerReferences = SetOwnerReference(pgw)
+	} else {
+		namespaceSelector.MatchNames = []string{pgw.Namespace}
 	}
 
 	endpoint := &monitoringv1.Endpoint{}
 
 	if override := pgw.Spec.ServiceMonitorOverrides; override != nil {
-		metadata.Labels = util.MergeLabels(labels, override.Labels)
+		metadata.Labels = util.MergeLabels(metadata.Labels, override.Labels)
 
 		if override.Endpoint != nil {
 			endpoint = override.Endpoint
 		}
 	}
 
-	// Those can't be overriden
+	// Those can't be overriden, nor can TLS and basic authentication when the web endpoint is secured
 	endpoint.Port = constants.PortName
-	endpoint.Scheme = "http"
+	endpoint.Scheme = GetWebScheme(pgw)
 	endpoint.Path = GetTelemetryPathOrDefault(pgw)
 	endpoint.HonorLabels = true
 	endpoint.HonorTimestamps = &truevar
 
+	if tlsConfig := scrapeTLSConfig(pgw); tlsConfig != nil {
+		endpoint.TLSConfig = &monitoringv1.TLSConfig{SafeTLSConfig: *tlsConfig}
+	}
+	if basicAuth := scrapeBasicAuth(pgw); basicAuth != nil {
+		endpoint.BasicAuth = basicAuth
+	}
+
 	// Create a basic service monitor
 	svcmon := &monitoringv1.ServiceMonitor{
 		ObjectMeta: metadata,
 		Spec: monitoringv1.ServiceMonitorSpec{
 			Selector: metav1.LabelSelector{
-				MatchLabels: PushgatewayLabels(pgw),
+				MatchLabels: ServedLabels(pgw),
 			},
+			NamespaceSelector: namespaceSelector,
 			Endpoints: []monitoringv1.Endpoint{
 				*endpoint,
 			},
@@ -74,35 +74,46 @@ func PushgatewayServiceMonitor(pgw *monitoringv1alpha1.Pushgateway) *monitoringv
 	return svcmon
 }
 
+// ServiceMonitorNamespace returns the namespace the ServiceMonitor is created in.
+// Defaults to the Pushgateway namespace.
+func ServiceMonitorNamespace(pgw *monitoringv1alpha1.Pushgateway) string {
+	if pgw.Status.ServiceMonitorNamespace != "" {
+		return pgw.Status.ServiceMonitorNamespace
+	}
+	return pgw.Namespace
+}
+
+// PrometheusSelectedLabels returns the Pushgateway labels, merged with labels
+// matching the selector of the Prometheus instance linked to the Pushgateway
+func PrometheusSelectedLabels(pgw *monitoringv1alpha1.Pushgateway, promSelector *metav1.LabelSelector) map[string]string {
+	labels := PushgatewayLabels(pgw)
+
+	// Find linked Prometheus instance label selector and merge it to the labels
+	if promSelector != nil && pgw.Status.Prometheus != "N/A" {
+		// Add labels under MatchLabels
+		labels = util.MergeLabels(labels, promSelector.MatchLabels)
+
+		//Iterate over MatchExpressions and make sure the labels match
+		labels = HandleMatchExpressions(labels, promSelector.MatchExpressions)
+	}
+
+	return labels
+}
+
 func HandleMatchExpressions(labels map[string]string, matchExp []metav1.LabelSelectorRequirement) map[string]string {
 	for _, exp := range matchExp {
 		switch exp.Operator {
 		case metav1.LabelSelectorOpIn:
-			if _, exists := labels[exp.Key]; !exists {
+			if val, exists := labels[exp.Key]; !exists || !containsString(exp.Values, val) {
 				//According to documentation Values must contain at least one element
 				// This is a sure match
 				labels[exp.Key] = exp.Values[0]
 			}
 		case metav1.LabelSelectorOpNotIn:
-			if _, exists := labels[exp.Key]; !exists {
-				// In this case we want the key to exist, but not to be in the Values array
-				currentTime := time.Now()
-				labels[exp.Key] = currentTime.Format("2006-01-02-15-04-05-000000") //Meaningless default value
-			}
-			if _, exists := labels[exp.Key]; exists {
-				repeat := true
-				i := 0
-				for repeat && i < constants.SERVICE_MONITOR_MAX_REPEAT {
-					repeat = false
-					for _, val := range exp.Values {
-						if val == labels[exp.Key] {
-							currentTime := time.Now()
-							labels[exp.Key] = currentTime.Format("2006-01-02-15-04-05-000000")
-							repeat = true
-						}
-					}
-					i++
-				}
+			// In this case we want the key to exist, but not to be in the Values array.
+			// The value must not change between reconciles, or the monitor would be updated every time.
+			if val, exists := labels[exp.Key]; !exists || containsString(exp.Values, val) {
+				labels[exp.Key] = notInValue(exp.Values)
 			}
 		case metav1.LabelSelectorOpExists:
 			if _, exists := labels[exp.Key]; !exists {
@@ -116,3 +127,21 @@ func HandleMatchExpressions(labels map[string]string, matchExp []metav1.LabelSel
 	}
 	return labels
 }
+
+// notInValue returns a meaningless label value which is not one of values
+func notInValue(values []string) string {
+	value := constants.NotInLabelValue
+	for i := 1; containsString(values, value); i++ {
+		value = fmt.Sprintf("%s-%d", constants.NotInLabelValue, i)
+	}
+	return value
+}
+
+func containsString(values []string, val string) bool {
+	for _, v := range values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,6 @@
 package resources
 
 import (
-	"fmt"
-
 	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
 	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
 	"github.com/prometheus-operator/pushgateway-operator/internal/util"
@@ -27,6 +25,15 @@ func PushgatewayLabels(pgw *monitoringv1alpha1.Pushgateway) labels.Set {
 	return util.MergeLabels(constants.PushgatewayLabels(), pgw.Labels)
 }
 
+// OwnerLabels identify resources created for the Pushgateway,
+// including those the Pushgateway cannot own
+func OwnerLabels(pgw *monitoringv1alpha1.Pushgateway) map[string]string {
+	return map[string]string{
+		constants.OwnerNameLabelName:      pgw.Name,
+		constants.OwnerNamespaceLabelName: pgw.Namespace,
+	}
+}
+
 func GetImageOrDefault(pgw *monitoringv1alpha1.Pushgateway, defaultImage string) string {
 	image := defaultImage
 	if pgw.Spec.Image != "" {
@@ -35,6 +42,22 @@ func GetImageOrDefault(pgw *monitoringv1alpha1.Pushgateway, defaultImage string)
 	return image
 }
 
+// Sets the monitor type through spec.MonitorType or default to ServiceMonitor
+func GetMonitorTypeOrDefault(pgw *monitoringv1alpha1.Pushgateway) monitoringv1alpha1.MonitorType {
+	if pgw.Spec.MonitorType != "" {
+		return pgw.Spec.MonitorType
+	}
+	return monitoringv1alpha1.MonitorTypeServiceMonitor
+}
+
+// Sets the number of replicas through spec.Replicas or default to 1
+func GetReplicasOrDefault(pgw *monitoringv1alpha1.Pushgateway) int32 {
+	if pgw.Spec.Replicas > 0 {
+		return pgw.Spec.Replicas
+	}
+	return 1
+}
+
 // Sets the port through spec.Port or default port
 func GetPortOrDefault(pgw *monitoringv1alpha1.Pushgateway) int32 {
 	port := int32(constants.DefaultPort)
@@ -44,9 +67,51 @@ func GetPortOrDefault(pgw *monitoringv1alpha1.Pushgateway) int32 {
 	return port
 }
 
+// Sets the telemetry path through spec.TelemetryPath or default path
 func GetTelemetryPathOrDefault(pgw *monitoringv1alpha1.Pushgateway) string {
 	if pgw.Spec.TelemetryPath != "" {
-		return fmt.Sprintf("%s%s", constants.TelemetryPathArg, pgw.Spec.TelemetryPath)
+		return pgw.Spec.TelemetryPath
 	}
 	return constants.DefaultTelemetryPath
 }
+
+// Sets the name of the injected URL environment variable through spec.injection.envVarName or default to PUSHGATEWAY
+func GetInjectionEnvVarNameOrDefault(pgw *monitoringv1alpha1.Pushgateway) string {
+	if pgw.Spec.Injection != nil && pgw.Spec.Injection.EnvVarName != "" {
+		return pgw.Spec.Injection.EnvVarName
+	}
+	return constants.PushgatewayEnvVar
+}
+
+// Sets how the grouping key is injected through spec.injection.groupingKeyMode or default to URL
+func GetGroupingKeyModeOrDefault(pgw *monitoringv1alpha1.Pushgateway) monitoringv1alpha1.GroupingKeyMode {
+	if pgw.Spec.Injection != nil && pgw.Spec.Injection.GroupingKeyMode != "" {
+		return pgw.Spec.Injection.GroupingKeyMode
+	}
+	return monitoringv1alpha1.GroupingKeyModeURL
+}
+
+// Sets the prefix of the grouping key environment variables through
+// spec.injection.groupingKeyEnvVarPrefix or default to PUSHGATEWAY_LABEL_
+func GetGroupingKeyEnvVarPrefixOrDefault(pgw *monitoringv1alpha1.Pushgateway) string {
+	if pgw.Spec.Injection != nil && pgw.Spec.Injection.GroupingKeyEnvVarPrefix != "" {
+		return pgw.Spec.Injection.GroupingKeyEnvVarPrefix
+	}
+	return constants.DefaultGroupingKeyPrefix
+}
+
+// Sets how the runs of CronJobs are grouped through spec.injection.cronJobGroupingMode or default to CronJob
+func GetCronJobGroupingModeOrDefault(pgw *monitoringv1alpha1.Pushgateway) monitoringv1alpha1.CronJobGroupingMode {
+	if pgw.Spec.Injection != nil && pgw.Spec.Injection.CronJobGroupingMode != "" {
+		return pgw.Spec.Injection.CronJobGroupingMode
+	}
+	return monitoringv1alpha1.CronJobGroupingModeCronJob
+}
+
+// Sets whether Jobs opt in or out of injection through spec.injection.policy or default to OptIn
+func GetInjectionPolicyOrDefault(pgw *monitoringv1alpha1.Pushgateway) monitoringv1alpha1.InjectionPolicy {
+	if pgw.Spec.Injection != nil && pgw.Spec.Injection.Policy != "" {
+		return pgw.Spec.Injection.Policy
+	}
+	return monitoringv1alpha1.InjectionPolicyOptIn
+}
@@ -0,0 +1,78 @@
+package resources
+
+import (
+	"fmt"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func StatefulSetName(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s%s", pgw.Name, constants.StatefulSetSuffix)
+}
+
+// ShardName returns the name of the StatefulSet pod running the shard
+func ShardName(pgw *monitoringv1alpha1.Pushgateway, shard int32) string {
+	return fmt.Sprintf("%s-%d", StatefulSetName(pgw), shard)
+}
+
+// ShardFQDN returns the fully qualified host of the shard,
+// published by the headless Service of the Pushgateway
+func ShardFQDN(pgw *monitoringv1alpha1.Pushgateway, shard int32) string {
+	return fmt.Sprintf("%s.%s", ShardName(pgw, shard), ServiceFQDN(pgw))
+}
+
+// IsSharded returns whether the Pushgateway runs as a StatefulSet of shards
+func IsSharded(pgw *monitoringv1alpha1.Pushgateway) bool {
+	return pgw.Spec.Sharding != nil
+}
+
+// Sets the number of shards through spec.sharding.shards or default to 1
+func GetShardsOrDefault(pgw *monitoringv1alpha1.Pushgateway) int32 {
+	if pgw.Spec.Sharding != nil && pgw.Spec.Sharding.Shards > 0 {
+		return pgw.Spec.Sharding.Shards
+	}
+	return 1
+}
+
+// Creates a StatefulSet running a pod per shard of the Pushgateway or, in high availability mode,
+// the Pushgateway replicas the push proxy replicates to.
+// Pods don't depend on each other, so they are started and updated in parallel.
+func PushgatewayStatefulSet(pgw *monitoringv1alpha1.Pushgateway) *appsv1.StatefulSet {
+	replicas := GetShardsOrDefault(pgw)
+	labels := PushgatewayLabels(pgw)
+	serviceName := ServiceName(pgw)
+	template := PushgatewayPodTemplate(pgw)
+
+	if IsHighlyAvailable(pgw) {
+		replicas = GetReplicasOrDefault(pgw)
+		labels = ReplicaLabels(pgw)
+		serviceName = ReplicasServiceName(pgw)
+		template.Labels = util.MergeLabels(template.Labels, labels)
+		// Replicas on the same node would fail together
+		template.Spec.TopologySpreadConstraints = GetSpreadConstraintsOrDefault(pgw, labels)
+	}
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            StatefulSetName(pgw),
+			Namespace:       pgw.Namespace,
+			Labels:          labels,
+			OwnerReferences: SetOwnerReference(pgw),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template:            template,
+			Replicas:            &replicas,
+			ServiceName:         serviceName,
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+		},
+	}
+
+	return sts
+}
@@ -0,0 +1,330 @@
+package resources
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/util"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// WebCredentials are read from the Secrets referenced by Spec.Web
+type WebCredentials struct {
+	// Usernames mapped to plaintext passwords
+	Users map[string][]byte
+	// CA certificate the Pushgateway certificate is verified with
+	CA []byte
+	// Password of the user injected workloads push as, generated by the operator
+	PushPassword []byte
+	// Random salt of the web configuration hash, generated by the operator
+	Salt []byte `json:"-"`
+}
+
+type webConfig struct {
+	TLSServerConfig *tlsServerConfig  `json:"tls_server_config,omitempty"`
+	BasicAuthUsers  map[string]string `json:"basic_auth_users,omitempty"`
+}
+
+type tlsServerConfig struct {
+	CertFile       string `json:"cert_file"`
+	KeyFile        string `json:"key_file"`
+	ClientAuthType string `json:"client_auth_type,omitempty"`
+	ClientCAFile   string `json:"client_ca_file,omitempty"`
+}
+
+func WebConfigSecretName(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s%s", pgw.Name, constants.WebConfigSuffix)
+}
+
+func ScrapeSecretName(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s%s", pgw.Name, constants.ScrapeSecretSuffix)
+}
+
+// ClientSecretName is qualified with the Pushgateway namespace, as Jobs of a namespace
+// may be injected with Pushgateways of the same name in different namespaces
+func ClientSecretName(pgw *monitoringv1alpha1.Pushgateway) string {
+	return fmt.Sprintf("%s-%s%s", pgw.Namespace, pgw.Name, constants.ClientSecretSuffix)
+}
+
+// SecretLabels identify the Secrets of a type created for the Pushgateway
+func SecretLabels(pgw *monitoringv1alpha1.Pushgateway, secretType string) map[string]string {
+	return util.MergeLabels(OwnerLabels(pgw), map[string]string{
+		constants.SecretTypeLabelName: secretType,
+	})
+}
+
+// IsWebTLSEnabled returns whether or not the Pushgateway is served over TLS
+func IsWebTLSEnabled(pgw *monitoringv1alpha1.Pushgateway) bool {
+	return pgw.Spec.Web != nil && pgw.Spec.Web.TLS != nil
+}
+
+// IsWebBasicAuthEnabled returns whether or not the Pushgateway requires basic authentication
+func IsWebBasicAuthEnabled(pgw *monitoringv1alpha1.Pushgateway) bool {
+	return pgw.Spec.Web != nil && pgw.Spec.Web.BasicAuthUsers != nil
+}
+
+// GetWebScheme returns the scheme the Pushgateway is served with
+func GetWebScheme(pgw *monitoringv1alpha1.Pushgateway) string {
+	if IsWebTLSEnabled(pgw) {
+		return "https"
+	}
+	return "http"
+}
+
+// Creates a Secret holding the Pushgateway web configuration file, along with
+// the credentials the operator authenticates with
+func PushgatewayWebConfigSecret(pgw *monitoringv1alpha1.Pushgateway, creds *WebCredentials) (*corev1.Secret, error) {
+	config := webConfig{}
+
+	if tls := pgw.Spec.Web.TLS; tls != nil {
+		config.TLSServerConfig = &tlsServerConfig{
+			CertFile:       webConfigPath(constants.WebCertKey),
+			KeyFile:        webConfigPath(constants.WebKeyKey),
+			ClientAuthType: tls.ClientAuthType,
+		}
+		if tls.CA != nil {
+			config.TLSServerConfig.ClientCAFile = webConfigPath(constants.WebCAKey)
+		}
+	}
+
+	if IsWebBasicAuthEnabled(pgw) {
+		config.BasicAuthUsers = map[string]string{}
+		for user, password := range creds.Users {
+			hash, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+			if err != nil {
+				return nil, err
+			}
+			config.BasicAuthUsers[user] = string(hash)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword(creds.PushPassword, bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		config.BasicAuthUsers[constants.WebPushUsername] = string(hash)
+	}
+
+	rendered, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            WebConfigSecretName(pgw),
+			Namespace:       pgw.Namespace,
+			Labels:          util.MergeLabels(PushgatewayLabels(pgw), SecretLabels(pgw, constants.SecretTypeWebConfig)),
+			OwnerReferences: SetOwnerReference(pgw),
+			Annotations: map[string]string{
+				constants.WebConfigHashAnnotationName: WebConfigHash(pgw, creds),
+			},
+		},
+		Data: scrapeCredentials(pgw, creds),
+	}
+	secret.Data[constants.WebConfigKey] = rendered
+	secret.Data[constants.WebConfigSaltKey] = creds.Salt
+	if IsWebBasicAuthEnabled(pgw) {
+		secret.Data[constants.WebPushUsernameKey] = []byte(constants.WebPushUsername)
+		secret.Data[constants.WebPushPasswordKey] = creds.PushPassword
+	}
+
+	return secret, nil
+}
+
+// Creates a Secret in the monitor namespace holding the credentials
+// Prometheus scrapes the Pushgateway with
+func PushgatewayScrapeSecret(pgw *monitoringv1alpha1.Pushgateway, creds *WebCredentials, namespace string) *corev1.Secret {
+	metadata := metav1.ObjectMeta{
+		Name:      ScrapeSecretName(pgw),
+		Namespace: namespace,
+		Labels:    util.MergeLabels(PushgatewayLabels(pgw), SecretLabels(pgw, constants.SecretTypeScrape)),
+		Annotations: map[string]string{
+			constants.WebConfigHashAnnotationName: WebConfigHash(pgw, creds),
+		},
+	}
+
+	// Owner references cannot cross namespaces,
+	// Secrets in other namespaces are cleaned up by the finalizer
+	if namespace == pgw.Namespace {
+		metadata.OwnerReferences = SetOwnerReference(pgw)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metadata,
+		Data:       scrapeCredentials(pgw, creds),
+	}
+}
+
+// Creates a Secret in the namespace of injected Jobs holding the credentials
+// they push with, copied from the rendered web configuration Secret.
+// Only the push user is copied: the scrape user never leaves the Pushgateway
+// and monitor namespaces, so it can be rotated on its own.
+func PushgatewayClientSecret(pgw *monitoringv1alpha1.Pushgateway, webConfig *corev1.Secret, namespace string) *corev1.Secret {
+	metadata := metav1.ObjectMeta{
+		Name:      ClientSecretName(pgw),
+		Namespace: namespace,
+		Labels:    util.MergeLabels(PushgatewayLabels(pgw), SecretLabels(pgw, constants.SecretTypeClient)),
+		Annotations: map[string]string{
+			constants.WebConfigHashAnnotationName: webConfig.Annotations[constants.WebConfigHashAnnotationName],
+		},
+	}
+
+	// Owner references cannot cross namespaces,
+	// Secrets in other namespaces are cleaned up by the finalizer
+	if namespace == pgw.Namespace {
+		metadata.OwnerReferences = SetOwnerReference(pgw)
+	}
+
+	data := map[string][]byte{}
+	keys := map[string]string{
+		constants.WebPushUsernameKey: constants.WebUsernameKey,
+		constants.WebPushPasswordKey: constants.WebPasswordKey,
+		constants.WebCAKey:           constants.WebCAKey,
+	}
+	for from, to := range keys {
+		if value, ok := webConfig.Data[from]; ok {
+			data[to] = value
+		}
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metadata,
+		Data:       data,
+	}
+}
+
+// WebConfigHash identifies the web configuration, so rendered Secrets are
+// only updated when it changes, as hashed passwords differ every time.
+// The hash is copied along with the credentials into other namespaces, so it is
+// keyed with a random salt to keep the passwords from being guessed offline from it.
+func WebConfigHash(pgw *monitoringv1alpha1.Pushgateway, creds *WebCredentials) string {
+	data, _ := json.Marshal(struct {
+		Web   *monitoringv1alpha1.PushgatewayWeb
+		Creds *WebCredentials
+	}{pgw.Spec.Web, creds})
+
+	hash := hmac.New(sha256.New, creds.Salt)
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// GetScrapeUser returns the user Prometheus and the operator authenticate as
+func GetScrapeUser(pgw *monitoringv1alpha1.Pushgateway, creds *WebCredentials) string {
+	if pgw.Spec.Web.ScrapeUser != "" {
+		return pgw.Spec.Web.ScrapeUser
+	}
+
+	users := []string{}
+	for user := range creds.Users {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	if len(users) == 0 {
+		return ""
+	}
+	return users[0]
+}
+
+func scrapeCredentials(pgw *monitoringv1alpha1.Pushgateway, creds *WebCredentials) map[string][]byte {
+	data := map[string][]byte{}
+
+	if IsWebBasicAuthEnabled(pgw) {
+		user := GetScrapeUser(pgw, creds)
+		data[constants.WebUsernameKey] = []byte(user)
+		data[constants.WebPasswordKey] = creds.Users[user]
+	}
+
+	if len(creds.CA) > 0 {
+		data[constants.WebCAKey] = creds.CA
+	}
+
+	return data
+}
+
+// Creates the volume the web configuration and the TLS files are mounted from
+func PushgatewayWebConfigVolume(pgw *monitoringv1alpha1.Pushgateway) corev1.Volume {
+	sources := []corev1.VolumeProjection{
+		{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: WebConfigSecretName(pgw)},
+				Items: []corev1.KeyToPath{
+					{Key: constants.WebConfigKey, Path: constants.WebConfigKey},
+				},
+			},
+		},
+	}
+
+	if tls := pgw.Spec.Web.TLS; tls != nil {
+		sources = append(sources, secretKeyProjection(tls.Cert, constants.WebCertKey), secretKeyProjection(tls.Key, constants.WebKeyKey))
+		if tls.CA != nil {
+			sources = append(sources, secretKeyProjection(*tls.CA, constants.WebCAKey))
+		}
+	}
+
+	return corev1.Volume{
+		Name: constants.WebConfigVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: sources,
+			},
+		},
+	}
+}
+
+func secretKeyProjection(selector corev1.SecretKeySelector, path string) corev1.VolumeProjection {
+	return corev1.VolumeProjection{
+		Secret: &corev1.SecretProjection{
+			LocalObjectReference: selector.LocalObjectReference,
+			Items: []corev1.KeyToPath{
+				{Key: selector.Key, Path: path},
+			},
+		},
+	}
+}
+
+func webConfigPath(key string) string {
+	return fmt.Sprintf("%s/%s", constants.WebConfigMountPath, key)
+}
+
+// Returns the TLS configuration Prometheus verifies the Pushgateway with
+func scrapeTLSConfig(pgw *monitoringv1alpha1.Pushgateway) *monitoringv1.SafeTLSConfig {
+	if !IsWebTLSEnabled(pgw) {
+		return nil
+	}
+
+	tlsConfig := &monitoringv1.SafeTLSConfig{
+		// Targets are scraped through their IP
+		ServerName: ServiceFQDN(pgw),
+	}
+	if pgw.Spec.Web.TLS.CA != nil {
+		tlsConfig.CA.Secret = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: ScrapeSecretName(pgw)},
+			Key:                  constants.WebCAKey,
+		}
+	}
+	return tlsConfig
+}
+
+// Returns the credentials Prometheus authenticates with, from the scrape Secret
+func scrapeBasicAuth(pgw *monitoringv1alpha1.Pushgateway) *monitoringv1.BasicAuth {
+	if !IsWebBasicAuthEnabled(pgw) {
+		return nil
+	}
+
+	secret := corev1.LocalObjectReference{Name: ScrapeSecretName(pgw)}
+	return &monitoringv1.BasicAuth{
+		Username: corev1.SecretKeySelector{LocalObjectReference: secret, Key: constants.WebUsernameKey},
+		Password: corev1.SecretKeySelector{LocalObjectReference: secret, Key: constants.WebPasswordKey},
+	}
+}
@@ -0,0 +1,205 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestPushgatewayWebConfigSecret(t *testing.T) {
+	pgw := newWebPushgateway()
+	creds := newWebCredentials()
+
+	secret, err := PushgatewayWebConfigSecret(pgw, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := webConfig{}
+	if err := yaml.Unmarshal(secret.Data[constants.WebConfigKey], &config); err != nil {
+		t.Fatal(err)
+	}
+
+	wantTLS := &tlsServerConfig{
+		CertFile:       "/etc/pushgateway/web/tls.crt",
+		KeyFile:        "/etc/pushgateway/web/tls.key",
+		ClientAuthType: "VerifyClientCertIfGiven",
+		ClientCAFile:   "/etc/pushgateway/web/ca.crt",
+	}
+	if !reflect.DeepEqual(config.TLSServerConfig, wantTLS) {
+		t.Errorf("tls_server_config = %+v, want %+v", config.TLSServerConfig, wantTLS)
+	}
+
+	passwords := map[string][]byte{
+		"alice":                   []byte("alice-password"),
+		"bob":                     []byte("bob-password"),
+		constants.WebPushUsername: []byte("push-password"),
+	}
+	if len(config.BasicAuthUsers) != len(passwords) {
+		t.Errorf("basic_auth_users = %v, want %d users", config.BasicAuthUsers, len(passwords))
+	}
+	for user, password := range passwords {
+		if err := bcrypt.CompareHashAndPassword([]byte(config.BasicAuthUsers[user]), password); err != nil {
+			t.Errorf("password of %s: %s", user, err)
+		}
+	}
+
+	// The operator authenticates as the first user
+	wantData := map[string]string{
+		constants.WebUsernameKey:     "alice",
+		constants.WebPasswordKey:     "alice-password",
+		constants.WebCAKey:           "ca",
+		constants.WebPushUsernameKey: constants.WebPushUsername,
+		constants.WebPushPasswordKey: "push-password",
+	}
+	for key, value := range wantData {
+		if string(secret.Data[key]) != value {
+			t.Errorf("%s = %q, want %q", key, secret.Data[key], value)
+		}
+	}
+}
+
+func TestPushgatewayScrapeSecret(t *testing.T) {
+	pgw := newWebPushgateway()
+	pgw.Spec.Web.ScrapeUser = "bob"
+
+	secret := PushgatewayScrapeSecret(pgw, newWebCredentials(), "monitoring")
+
+	if len(secret.OwnerReferences) != 0 {
+		t.Error("Secret in another namespace is owned by the Pushgateway")
+	}
+	want := map[string][]byte{
+		constants.WebUsernameKey: []byte("bob"),
+		constants.WebPasswordKey: []byte("bob-password"),
+		constants.WebCAKey:       []byte("ca"),
+	}
+	if !reflect.DeepEqual(secret.Data, want) {
+		t.Errorf("data = %q, want %q", secret.Data, want)
+	}
+}
+
+func TestPushgatewayWebConfigVolume(t *testing.T) {
+	volume := PushgatewayWebConfigVolume(newWebPushgateway())
+
+	paths := map[string]string{}
+	for _, source := range volume.Projected.Sources {
+		for _, item := range source.Secret.Items {
+			paths[item.Path] = source.Secret.Name + "/" + item.Key
+		}
+	}
+	want := map[string]string{
+		constants.WebConfigKey: WebConfigSecretName(newPushgateway()) + "/" + constants.WebConfigKey,
+		constants.WebCertKey:   "pushgateway-tls/tls.crt",
+		constants.WebKeyKey:    "pushgateway-tls/tls.key",
+		constants.WebCAKey:     "pushgateway-ca/ca.crt",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("projected paths = %v, want %v", paths, want)
+	}
+}
+
+func TestScrapeEndpointSecurity(t *testing.T) {
+	pgw := newWebPushgateway()
+
+	if scheme := GetWebScheme(pgw); scheme != "https" {
+		t.Errorf("scheme = %s, want https", scheme)
+	}
+
+	tlsConfig := scrapeTLSConfig(pgw)
+	if tlsConfig == nil || tlsConfig.ServerName != "pushgateway-pushgateway.default.svc" {
+		t.Fatalf("TLS config = %+v, want the Service name as server name", tlsConfig)
+	}
+	if tlsConfig.CA.Secret == nil || tlsConfig.CA.Secret.Name != ScrapeSecretName(pgw) {
+		t.Errorf("CA = %+v, want the scrape Secret", tlsConfig.CA)
+	}
+
+	basicAuth := scrapeBasicAuth(pgw)
+	if basicAuth == nil || basicAuth.Username.Name != ScrapeSecretName(pgw) || basicAuth.Password.Key != constants.WebPasswordKey {
+		t.Errorf("basic auth = %+v, want the scrape Secret", basicAuth)
+	}
+
+	if scrapeTLSConfig(newPushgateway()) != nil || scrapeBasicAuth(newPushgateway()) != nil {
+		t.Error("unsecured Pushgateway scraped with credentials")
+	}
+}
+
+func TestWebConfigHash(t *testing.T) {
+	pgw := newWebPushgateway()
+	creds := newWebCredentials()
+
+	hash := WebConfigHash(pgw, creds)
+	if again := WebConfigHash(pgw, newWebCredentials()); again != hash {
+		t.Errorf("hash of the same configuration = %s, want %s", again, hash)
+	}
+
+	rotated := newWebCredentials()
+	rotated.Users["alice"] = []byte("rotated")
+	if WebConfigHash(pgw, rotated) == hash {
+		t.Error("hash did not change with the password")
+	}
+
+	// The hash cannot be computed from the passwords alone
+	resalted := newWebCredentials()
+	resalted.Salt = []byte("other-salt")
+	if WebConfigHash(pgw, resalted) == hash {
+		t.Error("hash did not change with the salt")
+	}
+}
+
+func TestWebConfigSaltStaysInPushgatewayNamespace(t *testing.T) {
+	pgw := newWebPushgateway()
+	webConfig, err := PushgatewayWebConfigSecret(pgw, newWebCredentials())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(webConfig.Data[constants.WebConfigSaltKey]) != "salt" {
+		t.Errorf("salt = %q, want salt", webConfig.Data[constants.WebConfigSaltKey])
+	}
+	if webConfig.Labels[constants.SecretTypeLabelName] != constants.SecretTypeWebConfig {
+		t.Errorf("labels = %v, want the web config Secret type", webConfig.Labels)
+	}
+
+	for _, secret := range []*corev1.Secret{
+		PushgatewayScrapeSecret(pgw, newWebCredentials(), "monitoring"),
+		PushgatewayClientSecret(pgw, webConfig, "jobs"),
+	} {
+		if _, ok := secret.Data[constants.WebConfigSaltKey]; ok {
+			t.Errorf("salt copied to Secret %s/%s", secret.Namespace, secret.Name)
+		}
+	}
+}
+
+func newWebPushgateway() *monitoringv1alpha1.Pushgateway {
+	pgw := newPushgateway()
+	pgw.Spec.Web = &monitoringv1alpha1.PushgatewayWeb{
+		TLS: &monitoringv1alpha1.PushgatewayWebTLS{
+			Cert: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "pushgateway-tls"}, Key: "tls.crt"},
+			Key:  corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "pushgateway-tls"}, Key: "tls.key"},
+			CA: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "pushgateway-ca"},
+				Key:                  "ca.crt",
+			},
+			ClientAuthType: "VerifyClientCertIfGiven",
+		},
+		BasicAuthUsers: &corev1.LocalObjectReference{Name: "pushgateway-users"},
+	}
+	return pgw
+}
+
+func newWebCredentials() *WebCredentials {
+	return &WebCredentials{
+		Users: map[string][]byte{
+			"alice": []byte("alice-password"),
+			"bob":   []byte("bob-password"),
+		},
+		CA:           []byte("ca"),
+		PushPassword: []byte("push-password"),
+		Salt:         []byte("salt"),
+	}
+}
@@ -0,0 +1,174 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/injection"
+	"github.com/prometheus-operator/pushgateway-operator/internal/metrics"
+)
+
+const InjectorPath = "/mutate-pushgateway-injection"
+
+// Injector injects the Pushgateway environment variables into pods and the
+// pod template of workloads when they are admitted, so they don't have to be re-created.
+type Injector struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	decoder  *admission.Decoder
+}
+
+// Only objects labeled for injection, and objects of namespaces labeled for injection, are sent
+// to the injector, outside of kube-system and the operator namespace. Markers cannot set selectors,
+// they are set by config/webhook/injection_selectors_patch.yaml.
+//+kubebuilder:webhook:path=/mutate-pushgateway-injection,mutating=true,failurePolicy=ignore,sideEffects=NoneOnDryRun,groups="";apps;batch,resources=pods;pods/ephemeralcontainers;deployments;statefulsets;daemonsets;jobs;cronjobs,verbs=create;update,versions=v1,name=minjection.pushgateway.monitoring.coreos.com,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/mutate-pushgateway-injection,mutating=true,failurePolicy=ignore,sideEffects=NoneOnDryRun,groups="";apps;batch,resources=pods;pods/ephemeralcontainers;deployments;statefulsets;daemonsets;jobs;cronjobs,verbs=create;update,versions=v1,name=mnsinjection.pushgateway.monitoring.coreos.com,admissionReviewVersions=v1
+
+func (i *Injector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	logger := log.FromContext(ctx)
+
+	obj := injection.NewObject(schema.GroupKind{Group: req.Kind.Group, Kind: req.Kind.Kind})
+	if obj == nil {
+		return admission.Allowed(fmt.Sprintf("%s cannot be injected", req.Kind.Kind))
+	}
+	if err := i.decoder.Decode(req, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// The object may not be named yet
+	obj.SetNamespace(req.Namespace)
+	if obj.GetName() == "" {
+		obj.SetName(req.Name)
+	}
+	kind := req.Kind.Kind
+	name := fmt.Sprintf("%s %s/%s", kind, obj.GetNamespace(), obj.GetName())
+
+	// Ephemeral containers are only added to running pods
+	if pod, ok := obj.(*corev1.Pod); ok && req.SubResource == "ephemeralcontainers" {
+		return i.injectEphemeralContainers(pod, req, ctx)
+	}
+	if req.Operation == admissionv1.Update && injection.IsPodSpecImmutable(obj) {
+		return admission.Allowed(kind + " can only be injected when created")
+	}
+	if injection.IsInjectedThroughOwner(obj) {
+		return admission.Allowed(kind + " is injected through its owner")
+	}
+
+	pgw, err := injection.GetPushgatewayToInject(i.Client, obj, ctx)
+	if err != nil {
+		// Never block workload creation because of the Pushgateway
+		logger.Error(err, "Failed to inject "+name)
+		i.injectionFailed(obj, kind, err)
+		return admission.Allowed(err.Error())
+	}
+	if pgw == nil {
+		return i.uninject(obj, req)
+	}
+
+	// Secrets must not be created for dry-run requests
+	if req.DryRun == nil || !*req.DryRun {
+		if err := injection.EnsureClientSecret(i.Client, pgw, obj.GetNamespace(), ctx); err != nil {
+			logger.Error(err, "Failed to copy Pushgateway credentials for "+name)
+			i.injectionFailed(obj, kind, err)
+			return admission.Allowed(err.Error())
+		}
+	}
+
+	updated, err := injection.Inject(obj, pgw)
+	if err != nil {
+		logger.Error(err, "Failed to inject "+name)
+		i.injectionFailed(obj, kind, err)
+		return admission.Allowed(err.Error())
+	}
+	if !updated {
+		return admission.Allowed(kind + " is already injected")
+	}
+
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	logger.Info(name + " successfully injected")
+	if req.DryRun == nil || !*req.DryRun {
+		metrics.InjectedWorkloads.WithLabelValues(obj.GetNamespace(), kind).Inc()
+	}
+	i.Recorder.Event(obj, corev1.EventTypeNormal, constants.EventReasonInjected,
+		fmt.Sprintf("Injected with Pushgateway %s/%s", pgw.Namespace, pgw.Name))
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// Reports the failure to inject the object
+func (i *Injector) injectionFailed(obj client.Object, kind string, err error) {
+	i.Recorder.Event(obj, corev1.EventTypeWarning, constants.EventReasonInjectionFailed, err.Error())
+	metrics.InjectionFailures.WithLabelValues(obj.GetNamespace(), kind).Inc()
+}
+
+// InjectDecoder injects the decoder.
+func (i *Injector) InjectDecoder(d *admission.Decoder) error {
+	i.decoder = d
+	return nil
+}
+
+// Injects the ephemeral containers added to a pod with the Pushgateway the pod was injected
+// with when it was created. Pods injected through their owner don't record it, so their
+// ephemeral containers are not injected.
+func (i *Injector) injectEphemeralContainers(pod *corev1.Pod, req admission.Request, ctx context.Context) admission.Response {
+	logger := log.FromContext(ctx)
+	name := fmt.Sprintf("ephemeral containers of Pod %s/%s", pod.Namespace, pod.Name)
+
+	namespace, pgwName, err := cache.SplitMetaNamespaceKey(injection.GetInjectedPushgateway(pod))
+	if err != nil || pgwName == "" {
+		return admission.Allowed("ephemeral containers are only injected into pods injected when created")
+	}
+
+	pgw := &monitoringv1alpha1.Pushgateway{}
+	if err := i.Client.Get(ctx, types.NamespacedName{Name: pgwName, Namespace: namespace}, pgw); err != nil {
+		logger.Error(err, "Failed to inject "+name)
+		i.injectionFailed(pod, req.Kind.Kind, err)
+		return admission.Allowed(err.Error())
+	}
+
+	updated, err := injection.InjectEphemeralContainers(pod, pgw)
+	if err != nil {
+		logger.Error(err, "Failed to inject "+name)
+		i.injectionFailed(pod, req.Kind.Kind, err)
+		return admission.Allowed(err.Error())
+	}
+	if !updated {
+		return admission.Allowed("ephemeral containers are already injected")
+	}
+
+	marshaled, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	logger.Info(name + " successfully injected")
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// Removes what was injected into workloads which opted out
+func (i *Injector) uninject(obj client.Object, req admission.Request) admission.Response {
+	if injection.IsPodSpecImmutable(obj) || !injection.Uninject(obj) {
+		return admission.Allowed(req.Kind.Kind + " is not selected for injection")
+	}
+
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
@@ -0,0 +1,182 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestInjectorHandle(t *testing.T) {
+	controller := true
+	labeled := map[string]string{constants.PushgatewayLabelName: "true"}
+	podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "worker"}}}
+
+	tests := []struct {
+		name        string
+		operation   admissionv1.Operation
+		obj         client.Object
+		wantPatched bool
+	}{
+		{
+			name:      "labeled Deployment",
+			operation: admissionv1.Create,
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker", Labels: labeled},
+				Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec}},
+			},
+			wantPatched: true,
+		},
+		{
+			name:      "labeled Pod",
+			operation: admissionv1.Create,
+			obj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "driver", Labels: labeled},
+				Spec:       podSpec,
+			},
+			wantPatched: true,
+		},
+		{
+			name:      "Deployment not labeled",
+			operation: admissionv1.Create,
+			obj: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+				Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec}},
+			},
+		},
+		{
+			name:      "updated Pod",
+			operation: admissionv1.Update,
+			obj: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "driver", Labels: labeled},
+				Spec:       podSpec,
+			},
+		},
+		{
+			name:      "Job of a CronJob",
+			operation: admissionv1.Create,
+			obj: &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "report-1",
+					Labels: labeled,
+					OwnerReferences: []metav1.OwnerReference{
+						{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", Controller: &controller},
+					},
+				},
+				Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: podSpec}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := newInjector(t)
+			resp := injector.Handle(context.Background(), newAdmissionRequest(t, tt.operation, tt.obj))
+
+			if !resp.Allowed {
+				t.Fatalf("Handle() denied %s: %v", tt.name, resp.Result)
+			}
+			if patched := len(resp.Patches) > 0; patched != tt.wantPatched {
+				t.Fatalf("patched = %t, want %t: %v", patched, tt.wantPatched, resp.Result)
+			}
+			if !tt.wantPatched {
+				return
+			}
+
+			patches, _ := json.Marshal(resp.Patches)
+			if !strings.Contains(string(patches), constants.PushgatewayEnvVar) {
+				t.Errorf("patches = %s, want the %s environment variable", patches, constants.PushgatewayEnvVar)
+			}
+			if !strings.Contains(string(patches), constants.InjectedAnnotationName) {
+				t.Errorf("patches = %s, want the injection recorded", patches)
+			}
+		})
+	}
+}
+
+func TestInjectorHandleFailure(t *testing.T) {
+	injector := newInjector(t)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "driver", Labels: map[string]string{constants.PushgatewayLabelName: "missing"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "driver"}}},
+	}
+
+	resp := injector.Handle(context.Background(), newAdmissionRequest(t, admissionv1.Create, pod))
+
+	// Workloads are never blocked because of the Pushgateway
+	if !resp.Allowed || len(resp.Patches) > 0 {
+		t.Errorf("Handle() = %+v, want allowed without patches", resp)
+	}
+	if event := <-injector.Recorder.(*record.FakeRecorder).Events; !strings.Contains(event, constants.EventReasonInjectionFailed) {
+		t.Errorf("event = %s, want %s", event, constants.EventReasonInjectionFailed)
+	}
+}
+
+// Returns an injector of the jobs namespace, which has a single Pushgateway
+func newInjector(t *testing.T) *Injector {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		monitoringv1alpha1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector := &Injector{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "jobs"}},
+			&monitoringv1alpha1.Pushgateway{ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "jobs"}},
+		).Build(),
+		Recorder: record.NewFakeRecorder(10),
+	}
+	if err := injector.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+	return injector
+}
+
+func newAdmissionRequest(t *testing.T, operation admissionv1.Operation, obj client.Object) admission.Request {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kind := metav1.GroupVersionKind{Version: "v1"}
+	switch obj.(type) {
+	case *corev1.Pod:
+		kind.Kind = "Pod"
+	case *appsv1.Deployment:
+		kind.Group, kind.Kind = "apps", "Deployment"
+	case *batchv1.Job:
+		kind.Group, kind.Kind = "batch", "Job"
+	}
+
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		Kind:      kind,
+		Namespace: "jobs",
+		Name:      obj.GetName(),
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
@@ -0,0 +1,36 @@
+package webhooks
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/prometheus-operator/pushgateway-operator/internal/metrics"
+)
+
+// instrumentedHandler observes how long the handler takes to answer admission requests
+type instrumentedHandler struct {
+	name    string
+	handler admission.Handler
+}
+
+// Instrument returns the handler, observing its latency under the webhook name
+func Instrument(name string, handler admission.Handler) admission.Handler {
+	return &instrumentedHandler{name: name, handler: handler}
+}
+
+func (h *instrumentedHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	start := time.Now()
+	resp := h.handler.Handle(ctx, req)
+	metrics.WebhookDuration.WithLabelValues(h.name, string(req.Operation), strconv.FormatBool(resp.Allowed)).
+		Observe(time.Since(start).Seconds())
+	return resp
+}
+
+// InjectFunc injects the decoder and dependencies into the instrumented handler
+func (h *instrumentedHandler) InjectFunc(f inject.Func) error {
+	return f(h.handler)
+}
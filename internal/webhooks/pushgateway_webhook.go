@@ -0,0 +1,240 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/injection"
+	"github.com/prometheus-operator/pushgateway-operator/internal/resources"
+)
+
+const (
+	PushgatewayDefaulterPath = "/mutate-monitoring-coreos-com-v1alpha1-pushgateway"
+	PushgatewayValidatorPath = "/validate-monitoring-coreos-com-v1alpha1-pushgateway"
+)
+
+// PushgatewayDefaulter sets the defaults of Pushgateways when they are admitted,
+// so they show in the spec. The image is left out, so that Pushgateways follow
+// the default image of the operator when it is upgraded.
+type PushgatewayDefaulter struct {
+	decoder *admission.Decoder
+}
+
+//+kubebuilder:webhook:path=/mutate-monitoring-coreos-com-v1alpha1-pushgateway,mutating=true,failurePolicy=fail,sideEffects=None,groups=monitoring.coreos.com,resources=pushgateways,verbs=create;update,versions=v1alpha1,name=mpushgateway.monitoring.coreos.com,admissionReviewVersions=v1
+
+func (d *PushgatewayDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pgw := &monitoringv1alpha1.Pushgateway{}
+	if err := d.decoder.Decode(req, pgw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	setPushgatewayDefaults(pgw)
+
+	marshaled, err := json.Marshal(pgw)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+func setPushgatewayDefaults(pgw *monitoringv1alpha1.Pushgateway) {
+	if pgw.Spec.Port == 0 {
+		pgw.Spec.Port = constants.DefaultPort
+	}
+	if pgw.Spec.TelemetryPath == "" {
+		pgw.Spec.TelemetryPath = constants.DefaultTelemetryPath
+	}
+	if pgw.Spec.LogLevel == "" {
+		pgw.Spec.LogLevel = constants.DefaultLogLevel
+	}
+	if pgw.Spec.LogFormat == "" {
+		pgw.Spec.LogFormat = constants.DefaultLogFormat
+	}
+}
+
+// InjectDecoder injects the decoder.
+func (d *PushgatewayDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// PushgatewayValidator rejects invalid Pushgateways when they are admitted,
+// rather than failing to reconcile them
+type PushgatewayValidator struct {
+	Client client.Client
+	// Push proxy image of highly available Pushgateways not setting one, if any
+	DefaultProxyImage string
+	decoder           *admission.Decoder
+}
+
+//+kubebuilder:webhook:path=/validate-monitoring-coreos-com-v1alpha1-pushgateway,mutating=false,failurePolicy=fail,sideEffects=None,groups=monitoring.coreos.com,resources=pushgateways,verbs=create;update,versions=v1alpha1,name=vpushgateway.monitoring.coreos.com,admissionReviewVersions=v1
+
+func (v *PushgatewayValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pgw := &monitoringv1alpha1.Pushgateway{}
+	if err := v.decoder.Decode(req, pgw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	errs := validatePushgateway(pgw)
+	errs = append(errs, validateProxyImage(pgw, v.DefaultProxyImage)...)
+	if req.Operation == admissionv1.Update {
+		oldPgw := &monitoringv1alpha1.Pushgateway{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldPgw); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		errs = append(errs, validatePushgatewayUpdate(pgw, oldPgw)...)
+	}
+	if len(errs) > 0 {
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+
+	// The Prometheus may be created afterwards
+	warnings := []string{}
+	if warning := v.checkPrometheus(pgw, ctx); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// InjectDecoder injects the decoder.
+func (v *PushgatewayValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+func validatePushgateway(pgw *monitoringv1alpha1.Pushgateway) field.ErrorList {
+	errs := field.ErrorList{}
+	spec := field.NewPath("spec")
+
+	if pgw.Spec.Prometheus != nil && pgw.Spec.Prometheus.Name == "" {
+		errs = append(errs, field.Required(spec.Child("prometheus", "name"), "Prometheus name cannot be empty"))
+	}
+
+	if pgw.Spec.Port < 1 || pgw.Spec.Port > 65535 {
+		errs = append(errs, field.Invalid(spec.Child("port"), pgw.Spec.Port, "must be between 1 and 65535"))
+	}
+
+	if path := pgw.Spec.TelemetryPath; path != "" && !strings.HasPrefix(path, "/") {
+		errs = append(errs, field.Invalid(spec.Child("telemetryPath"), path, "must start with /"))
+	}
+
+	monitorType := pgw.Spec.MonitorType
+	if pgw.Spec.ServiceMonitorOverrides != nil && monitorType != "" && monitorType != monitoringv1alpha1.MonitorTypeServiceMonitor {
+		errs = append(errs, field.Forbidden(spec.Child("serviceMonitorOverrides"),
+			fmt.Sprintf("cannot be set with monitorType %s", monitorType)))
+	}
+
+	// Each shard would need its own volume
+	if pgw.Spec.Sharding != nil && pgw.Spec.Persistence != nil {
+		errs = append(errs, field.Forbidden(spec.Child("sharding"), "cannot be set with persistence"))
+	}
+
+	// Replicas would need their own volume, and the push proxy doesn't authenticate to them
+	if pgw.Spec.HighAvailability != nil {
+		highAvailability := spec.Child("highAvailability")
+		if pgw.Spec.Sharding != nil {
+			errs = append(errs, field.Forbidden(highAvailability, "cannot be set with sharding"))
+		}
+		if pgw.Spec.Persistence != nil {
+			errs = append(errs, field.Forbidden(highAvailability, "cannot be set with persistence"))
+		}
+		if pgw.Spec.Web != nil {
+			errs = append(errs, field.Forbidden(highAvailability, "cannot be set with web"))
+		}
+	}
+
+	// Injected workloads and the operator never present a client certificate
+	if web := pgw.Spec.Web; web != nil && web.TLS != nil {
+		switch web.TLS.ClientAuthType {
+		case "RequireAnyClientCert", "RequireAndVerifyClientCert":
+			errs = append(errs, field.Forbidden(spec.Child("web", "tls", "clientAuthType"),
+				fmt.Sprintf("%s cannot be used, injected workloads do not present a client certificate", web.TLS.ClientAuthType)))
+		}
+	}
+
+	if err := injection.ValidateGroupingKey(pgw); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("injection", "groupingKey"), pgw.Spec.Injection.GroupingKey, err.Error()))
+	}
+
+	return errs
+}
+
+// The push proxy image is required in high availability mode when the operator has no default
+func validateProxyImage(pgw *monitoringv1alpha1.Pushgateway, defaultImage string) field.ErrorList {
+	errs := field.ErrorList{}
+	if resources.IsHighlyAvailable(pgw) && resources.GetProxyImageOrDefault(pgw, defaultImage) == "" {
+		errs = append(errs, field.Required(field.NewPath("spec", "highAvailability", "proxyImage"),
+			"must be set, the operator has no default push proxy image"))
+	}
+	return errs
+}
+
+// Rejects the changes the reconciler could only apply by deleting the workload, along with
+// the metric groups it holds: switching between a Deployment and a StatefulSet, and changing
+// the labels selecting the StatefulSet pods. The PersistentVolumeClaim cannot be changed once
+// created, except to grow.
+func validatePushgatewayUpdate(pgw *monitoringv1alpha1.Pushgateway, oldPgw *monitoringv1alpha1.Pushgateway) field.ErrorList {
+	errs := field.ErrorList{}
+	spec := field.NewPath("spec")
+
+	if resources.IsSharded(pgw) != resources.IsSharded(oldPgw) {
+		errs = append(errs, field.Forbidden(spec.Child("sharding"), "cannot be set or unset once created"))
+	}
+	if resources.IsHighlyAvailable(pgw) != resources.IsHighlyAvailable(oldPgw) {
+		errs = append(errs, field.Forbidden(spec.Child("highAvailability"), "cannot be set or unset once created"))
+	}
+	if (resources.IsSharded(oldPgw) || resources.IsHighlyAvailable(oldPgw)) &&
+		!reflect.DeepEqual(resources.PushgatewayLabels(pgw), resources.PushgatewayLabels(oldPgw)) {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "labels"),
+			"cannot be changed once created when sharded or highly available, as they select the StatefulSet pods"))
+	}
+
+	if pgw.Spec.Persistence == nil || oldPgw.Spec.Persistence == nil {
+		return errs
+	}
+
+	persistence := spec.Child("persistence")
+	if !reflect.DeepEqual(pgw.Spec.Persistence.StorageClassName, oldPgw.Spec.Persistence.StorageClassName) {
+		errs = append(errs, field.Forbidden(persistence.Child("storageClassName"), "field is immutable"))
+	}
+	if pgw.Spec.Persistence.AccessMode != oldPgw.Spec.Persistence.AccessMode {
+		errs = append(errs, field.Forbidden(persistence.Child("accessMode"), "field is immutable"))
+	}
+	if size, oldSize := pgw.Spec.Persistence.Size, oldPgw.Spec.Persistence.Size; size != nil && oldSize != nil && size.Cmp(*oldSize) < 0 {
+		errs = append(errs, field.Forbidden(persistence.Child("size"), "cannot be decreased"))
+	}
+
+	return errs
+}
+
+// Returns a warning if the Prometheus the Pushgateway binds to does not exist
+func (v *PushgatewayValidator) checkPrometheus(pgw *monitoringv1alpha1.Pushgateway, ctx context.Context) string {
+	if pgw.Spec.Prometheus == nil {
+		return ""
+	}
+
+	namespace := pgw.Namespace
+	if pgw.Spec.Prometheus.Namespace != "" {
+		namespace = pgw.Spec.Prometheus.Namespace
+	}
+
+	err := v.Client.Get(ctx, types.NamespacedName{Name: pgw.Spec.Prometheus.Name, Namespace: namespace}, &monitoringv1.Prometheus{})
+	if k8serrors.IsNotFound(err) {
+		return fmt.Sprintf("Prometheus %s/%s not found", namespace, pgw.Spec.Prometheus.Name)
+	}
+	return ""
+}
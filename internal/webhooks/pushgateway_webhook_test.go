@@ -0,0 +1,302 @@
+package webhooks
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
+	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+)
+
+func TestValidatePushgateway(t *testing.T) {
+	tls := &monitoringv1alpha1.PushgatewayWebTLS{}
+	tests := []struct {
+		name       string
+		spec       monitoringv1alpha1.PushgatewaySpec
+		wantFields []string
+	}{
+		{name: "default"},
+		{
+			name: "valid",
+			spec: monitoringv1alpha1.PushgatewaySpec{
+				Prometheus:    &monitoringv1alpha1.PushgatewayPrometheus{Name: "k8s"},
+				Port:          9092,
+				TelemetryPath: "/push",
+				MonitorType:   monitoringv1alpha1.MonitorTypeServiceMonitor,
+				Persistence:   &monitoringv1alpha1.PushgatewayPersistence{},
+				Web: &monitoringv1alpha1.PushgatewayWeb{
+					TLS: &monitoringv1alpha1.PushgatewayWebTLS{ClientAuthType: "VerifyClientCertIfGiven"},
+				},
+			},
+		},
+		{
+			name:       "Prometheus without name",
+			spec:       monitoringv1alpha1.PushgatewaySpec{Prometheus: &monitoringv1alpha1.PushgatewayPrometheus{}},
+			wantFields: []string{"spec.prometheus.name"},
+		},
+		{
+			name:       "relative telemetry path",
+			spec:       monitoringv1alpha1.PushgatewaySpec{TelemetryPath: "metrics"},
+			wantFields: []string{"spec.telemetryPath"},
+		},
+		{
+			name: "ServiceMonitor overrides with a PodMonitor",
+			spec: monitoringv1alpha1.PushgatewaySpec{
+				MonitorType:             monitoringv1alpha1.MonitorTypePodMonitor,
+				ServiceMonitorOverrides: &monitoringv1alpha1.ServiceMonitorOverride{},
+			},
+			wantFields: []string{"spec.serviceMonitorOverrides"},
+		},
+		{
+			name: "sharding with persistence",
+			spec: monitoringv1alpha1.PushgatewaySpec{
+				Sharding:    &monitoringv1alpha1.PushgatewaySharding{Shards: 2},
+				Persistence: &monitoringv1alpha1.PushgatewayPersistence{},
+			},
+			wantFields: []string{"spec.sharding"},
+		},
+		{
+			name: "high availability with sharding, persistence and web",
+			spec: monitoringv1alpha1.PushgatewaySpec{
+				HighAvailability: &monitoringv1alpha1.PushgatewayHighAvailability{},
+				Sharding:         &monitoringv1alpha1.PushgatewaySharding{Shards: 2},
+				Persistence:      &monitoringv1alpha1.PushgatewayPersistence{},
+				Web:              &monitoringv1alpha1.PushgatewayWeb{TLS: tls},
+			},
+			wantFields: []string{
+				"spec.sharding",
+				"spec.highAvailability",
+				"spec.highAvailability",
+				"spec.highAvailability",
+			},
+		},
+		{
+			name: "client certificate required",
+			spec: monitoringv1alpha1.PushgatewaySpec{
+				Web: &monitoringv1alpha1.PushgatewayWeb{
+					TLS: &monitoringv1alpha1.PushgatewayWebTLS{ClientAuthType: "RequireAndVerifyClientCert"},
+				},
+			},
+			wantFields: []string{"spec.web.tls.clientAuthType"},
+		},
+		{
+			name: "invalid grouping key",
+			spec: monitoringv1alpha1.PushgatewaySpec{
+				Injection: &monitoringv1alpha1.PushgatewayInjection{
+					GroupingKey: []monitoringv1alpha1.GroupingKeyLabel{{Name: "job", Value: "{{.Name"}},
+				},
+			},
+			wantFields: []string{"spec.injection.groupingKey"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := newPushgateway(tt.spec)
+			if got := errorFields(validatePushgateway(pgw)); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("validatePushgateway() fields = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestValidatePushgatewayPort(t *testing.T) {
+	tests := []struct {
+		port    int32
+		wantErr bool
+	}{
+		{port: 0, wantErr: true},
+		{port: 1},
+		{port: 65535},
+		{port: 65536, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.port), func(t *testing.T) {
+			pgw := newPushgateway(monitoringv1alpha1.PushgatewaySpec{})
+			pgw.Spec.Port = tt.port
+			if got := errorFields(validatePushgateway(pgw)); (got != nil) != tt.wantErr {
+				t.Errorf("validatePushgateway() fields = %v, wantErr %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateProxyImage(t *testing.T) {
+	tests := []struct {
+		name             string
+		highAvailability *monitoringv1alpha1.PushgatewayHighAvailability
+		defaultImage     string
+		wantFields       []string
+	}{
+		{name: "not highly available"},
+		{name: "proxy image set", highAvailability: &monitoringv1alpha1.PushgatewayHighAvailability{ProxyImage: "registry.example.com/push-proxy:v0.1.0"}},
+		{name: "operator default image", highAvailability: &monitoringv1alpha1.PushgatewayHighAvailability{}, defaultImage: "registry.example.com/push-proxy:v0.1.0"},
+		{name: "no image", highAvailability: &monitoringv1alpha1.PushgatewayHighAvailability{}, wantFields: []string{"spec.highAvailability.proxyImage"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgw := newPushgateway(monitoringv1alpha1.PushgatewaySpec{HighAvailability: tt.highAvailability})
+			if got := errorFields(validateProxyImage(pgw, tt.defaultImage)); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("validateProxyImage() fields = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestSetPushgatewayDefaults(t *testing.T) {
+	pgw := &monitoringv1alpha1.Pushgateway{}
+	setPushgatewayDefaults(pgw)
+
+	want := monitoringv1alpha1.PushgatewaySpec{
+		Port:          constants.DefaultPort,
+		TelemetryPath: constants.DefaultTelemetryPath,
+		LogLevel:      constants.DefaultLogLevel,
+		LogFormat:     constants.DefaultLogFormat,
+	}
+	// The image is resolved when rendered, so the operator default image applies after upgrades
+	if !reflect.DeepEqual(pgw.Spec, want) {
+		t.Errorf("setPushgatewayDefaults() = %+v, want %+v", pgw.Spec, want)
+	}
+
+	pgw.Spec.Port = 9092
+	setPushgatewayDefaults(pgw)
+	if pgw.Spec.Port != 9092 {
+		t.Errorf("port = %d, want the one set 9092", pgw.Spec.Port)
+	}
+}
+
+func TestValidatePushgatewayUpdate(t *testing.T) {
+	standard := "standard"
+	fast := "fast"
+	small := resource.MustParse("1Gi")
+	large := resource.MustParse("2Gi")
+
+	oldPersistence := &monitoringv1alpha1.PushgatewayPersistence{
+		StorageClassName: &standard,
+		Size:             &large,
+		AccessMode:       corev1.ReadWriteOnce,
+	}
+
+	tests := []struct {
+		name        string
+		persistence *monitoringv1alpha1.PushgatewayPersistence
+		wantFields  []string
+	}{
+		{name: "unchanged", persistence: oldPersistence.DeepCopy()},
+		{name: "persistence removed"},
+		{
+			name:        "grown",
+			persistence: &monitoringv1alpha1.PushgatewayPersistence{StorageClassName: &standard, Size: resource.NewQuantity(3<<30, resource.BinarySI), AccessMode: corev1.ReadWriteOnce},
+		},
+		{
+			name:        "storage class changed",
+			persistence: &monitoringv1alpha1.PushgatewayPersistence{StorageClassName: &fast, Size: &large, AccessMode: corev1.ReadWriteOnce},
+			wantFields:  []string{"spec.persistence.storageClassName"},
+		},
+		{
+			name:        "storage class unset",
+			persistence: &monitoringv1alpha1.PushgatewayPersistence{Size: &large, AccessMode: corev1.ReadWriteOnce},
+			wantFields:  []string{"spec.persistence.storageClassName"},
+		},
+		{
+			name:        "access mode changed",
+			persistence: &monitoringv1alpha1.PushgatewayPersistence{StorageClassName: &standard, Size: &large, AccessMode: corev1.ReadWriteMany},
+			wantFields:  []string{"spec.persistence.accessMode"},
+		},
+		{
+			name:        "shrunk",
+			persistence: &monitoringv1alpha1.PushgatewayPersistence{StorageClassName: &standard, Size: &small, AccessMode: corev1.ReadWriteOnce},
+			wantFields:  []string{"spec.persistence.size"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldPgw := newPushgateway(monitoringv1alpha1.PushgatewaySpec{Persistence: oldPersistence})
+			pgw := newPushgateway(monitoringv1alpha1.PushgatewaySpec{Persistence: tt.persistence})
+			if got := errorFields(validatePushgatewayUpdate(pgw, oldPgw)); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("validatePushgatewayUpdate() fields = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestValidatePushgatewayWorkloadUpdate(t *testing.T) {
+	sharding := &monitoringv1alpha1.PushgatewaySharding{Shards: 2}
+	highAvailability := &monitoringv1alpha1.PushgatewayHighAvailability{}
+
+	tests := []struct {
+		name       string
+		oldSpec    monitoringv1alpha1.PushgatewaySpec
+		spec       monitoringv1alpha1.PushgatewaySpec
+		labels     map[string]string
+		wantFields []string
+	}{
+		{name: "Deployment relabeled", labels: map[string]string{"team": "data"}},
+		{
+			name:    "shards scaled",
+			oldSpec: monitoringv1alpha1.PushgatewaySpec{Sharding: sharding},
+			spec:    monitoringv1alpha1.PushgatewaySpec{Sharding: &monitoringv1alpha1.PushgatewaySharding{Shards: 3}},
+		},
+		{
+			name:       "sharding enabled",
+			spec:       monitoringv1alpha1.PushgatewaySpec{Sharding: sharding},
+			wantFields: []string{"spec.sharding"},
+		},
+		{
+			name:       "high availability disabled",
+			oldSpec:    monitoringv1alpha1.PushgatewaySpec{HighAvailability: highAvailability},
+			wantFields: []string{"spec.highAvailability"},
+		},
+		{
+			name:       "sharding switched to high availability",
+			oldSpec:    monitoringv1alpha1.PushgatewaySpec{Sharding: sharding},
+			spec:       monitoringv1alpha1.PushgatewaySpec{HighAvailability: highAvailability},
+			wantFields: []string{"spec.sharding", "spec.highAvailability"},
+		},
+		{
+			name:       "StatefulSet relabeled",
+			oldSpec:    monitoringv1alpha1.PushgatewaySpec{Sharding: sharding},
+			spec:       monitoringv1alpha1.PushgatewaySpec{Sharding: sharding},
+			labels:     map[string]string{"team": "data"},
+			wantFields: []string{"metadata.labels"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldPgw := newPushgateway(tt.oldSpec)
+			pgw := newPushgateway(tt.spec)
+			pgw.Labels = tt.labels
+			if got := errorFields(validatePushgatewayUpdate(pgw, oldPgw)); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("validatePushgatewayUpdate() fields = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func errorFields(errs field.ErrorList) []string {
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+// Returns a Pushgateway with the defaults set, as validated after the defaulter ran
+func newPushgateway(spec monitoringv1alpha1.PushgatewaySpec) *monitoringv1alpha1.Pushgateway {
+	pgw := &monitoringv1alpha1.Pushgateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "pushgateway", Namespace: "default"},
+		Spec:       spec,
+	}
+	setPushgatewayDefaults(pgw)
+	return pgw
+}
@@ -18,23 +18,36 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	monitoringv1alpha1 "github.com/prometheus-operator/pushgateway-operator/api/v1alpha1"
 	"github.com/prometheus-operator/pushgateway-operator/controllers"
 	"github.com/prometheus-operator/pushgateway-operator/internal/constants"
+	"github.com/prometheus-operator/pushgateway-operator/internal/metrics"
+	"github.com/prometheus-operator/pushgateway-operator/internal/pushgateway"
+	"github.com/prometheus-operator/pushgateway-operator/internal/webhooks"
+	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	//+kubebuilder:scaffold:imports
 )
@@ -56,12 +69,33 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var pushgatewayDefaultImage string
+	var pushProxyDefaultImage string
+	var enableJobWebhooks bool
+	var enablePushgatewayWebhooks bool
+	var enableJobControllers bool
+	var enableReinjectionControllers bool
+	var metricRetentionInterval time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&pushgatewayDefaultImage, "pushgateway-default-image", constants.DefaultImage, "Pushgateway default image")
+	flag.StringVar(&pushProxyDefaultImage, "push-proxy-default-image", "",
+		"Push proxy default image, run in front of highly available Pushgateways. "+
+			"If empty, highly available Pushgateways must set spec.highAvailability.proxyImage.")
+	flag.BoolVar(&enableJobWebhooks, "enable-job-webhooks", true,
+		"Inject pods and workloads at admission time through a mutating webhook.")
+	flag.BoolVar(&enablePushgatewayWebhooks, "enable-pushgateway-webhooks", true,
+		"Default and validate Pushgateways at admission time through webhooks.")
+	flag.BoolVar(&enableJobControllers, "enable-job-controllers", false,
+		"Inject Jobs by deleting and re-creating them. "+
+			"Fallback for clusters where admission webhooks cannot be used.")
+	flag.BoolVar(&enableReinjectionControllers, "enable-reinjection-controllers", true,
+		"Re-evaluate the injection of CronJobs, Deployments, StatefulSets and DaemonSets by updating them in place "+
+			"when their namespace or Pushgateway changes. Jobs are only re-created with --enable-job-controllers.")
+	flag.DurationVar(&metricRetentionInterval, "metric-retention-interval", time.Minute,
+		"How often metric groups are checked against the retention of their Pushgateway.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -70,6 +104,13 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// Only the Secrets created by the operator are cached, not every Secret of the cluster
+	operatorSecrets, err := labels.NewRequirement(constants.SecretTypeLabelName, selection.Exists, nil)
+	if err != nil {
+		setupLog.Error(err, "unable to select operator Secrets")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -78,6 +119,11 @@ func main() {
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "d9a598a3.coreos.com",
 		Namespace:              "",
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Secret{}: {Label: labels.NewSelector().Add(*operatorSecrets)},
+			},
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -95,31 +141,89 @@ func main() {
 	}
 
 	if err = (&controllers.PushgatewayReconciler{
-		Client:       mgr.GetClient(),
-		Scheme:       mgr.GetScheme(),
-		DefaultImage: pushgatewayDefaultImage,
+		Client:            mgr.GetClient(),
+		APIReader:         mgr.GetAPIReader(),
+		Scheme:            mgr.GetScheme(),
+		DefaultImage:      pushgatewayDefaultImage,
+		DefaultProxyImage: pushProxyDefaultImage,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Pushgateway")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.JobReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+	// Connections to Pushgateways are shared by the controllers talking to them
+	pushgatewayClient := pushgateway.NewClient(mgr.GetClient())
+
+	// Only Jobs injected with a Pushgateway with Spec.JobCleanup set are cleaned up
+	if err = (&controllers.JobCleanupReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Recorder:    mgr.GetEventRecorderFor("pushgateway-operator"),
+		Pushgateway: pushgatewayClient,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Job")
+		setupLog.Error(err, "unable to create controller", "controller", "JobCleanup")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.CronJobReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "CronJob")
+	// Only Pushgateways with a metric retention are checked
+	if err = mgr.Add(&controllers.MetricRetentionRunner{
+		Client:      mgr.GetClient(),
+		Pushgateway: pushgatewayClient,
+		Interval:    metricRetentionInterval,
+	}); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "MetricRetention")
 		os.Exit(1)
 	}
+
+	// Workloads updated in place are re-evaluated when their namespace or
+	// Pushgateway changes, which the webhook cannot see
+	var injectedObjects []client.Object
+	if enableReinjectionControllers {
+		injectedObjects = append(injectedObjects, &batchv1.CronJob{}, &appsv1.Deployment{}, &appsv1.StatefulSet{}, &appsv1.DaemonSet{})
+	}
+	if enableJobControllers {
+		// Pods cannot be re-created without disrupting them
+		injectedObjects = append(injectedObjects, &batchv1.Job{})
+	}
+	for _, obj := range injectedObjects {
+		if err = (&controllers.InjectionReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("pushgateway-operator"),
+			Object:   obj,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", fmt.Sprintf("%T", obj))
+			os.Exit(1)
+		}
+	}
+
+	// The webhook server needs serving certificates, so it is only started when a webhook is enabled
+	if enableJobWebhooks {
+		mgr.GetWebhookServer().Register(webhooks.InjectorPath, &webhook.Admission{
+			Handler: webhooks.Instrument("injector", &webhooks.Injector{
+				Client:   mgr.GetClient(),
+				Recorder: mgr.GetEventRecorderFor("pushgateway-operator"),
+			}),
+		})
+	}
+	if enablePushgatewayWebhooks {
+		mgr.GetWebhookServer().Register(webhooks.PushgatewayDefaulterPath, &webhook.Admission{
+			Handler: webhooks.Instrument("pushgateway-defaulter", &webhooks.PushgatewayDefaulter{}),
+		})
+		mgr.GetWebhookServer().Register(webhooks.PushgatewayValidatorPath, &webhook.Admission{
+			Handler: webhooks.Instrument("pushgateway-validator", &webhooks.PushgatewayValidator{
+				Client:            mgr.GetClient(),
+				DefaultProxyImage: pushProxyDefaultImage,
+			}),
+		})
+	}
 	//+kubebuilder:scaffold:builder
 
+	if err := ctrlmetrics.Registry.Register(&metrics.PushgatewayCollector{Reader: mgr.GetClient()}); err != nil {
+		setupLog.Error(err, "unable to register Pushgateway metrics")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)